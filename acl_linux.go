@@ -0,0 +1,32 @@
+package main
+
+import (
+	"errors"
+
+	"golang.org/x/sys/unix"
+)
+
+// Linux stores a file's access ACL as a binary extended attribute that
+// every filesystem with ACL support understands, so it can be copied as is.
+const aclAccess = "system.posix_acl_access"
+
+func checkACLs() error { return nil }
+
+// copyACL copies the access ACL of src to dst. It reports false if dst
+// can't hold it. Files without an ACL beyond their mode are left alone.
+func copyACL(src, dst string) (bool, error) {
+	data, err := getXattr(src, aclAccess)
+	if errors.Is(err, unix.ENODATA) || err != nil && isUnsupported(err) {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if err := unix.Setxattr(dst, aclAccess, data, 0); err != nil {
+		if isUnsupported(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// planHeader starts the first line of every plan file. Resume lists skip it
+// so plan files can also be passed to --resume.
+const planHeader = "# splitcopy plan source="
+
+type ApplyCmd struct {
+	Plan        string `arg:"" help:"File list written by plan." type:"existingfile"`
+	Destination string `arg:"" help:"Destination directory." type:"path"`
+
+	Source string `placeholder:"DIR" type:"existingdir" help:"Source directory (default: the one recorded in the plan)."`
+
+	CopyFlags `embed:""`
+}
+
+func (a *ApplyCmd) Validate() error {
+	if a.Delete {
+		return errors.New("--delete can't be used with apply: a plan only lists part of the source")
+	}
+	return a.CopyFlags.validate()
+}
+
+func readPlan(name string) (source string, paths []string, err error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return "", nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if src, ok := strings.CutPrefix(line, planHeader); ok {
+			source = src
+			continue
+		}
+		if line != "" {
+			paths = append(paths, line)
+		}
+	}
+	return source, paths, scanner.Err()
+}
+
+// Run copies exactly the files in a plan, after checking that each one is
+// still in the source.
+func (a *ApplyCmd) Run() error {
+	source, paths, err := readPlan(a.Plan)
+	if err != nil {
+		return err
+	}
+	if a.Source != "" {
+		source = a.Source
+	}
+	if source == "" {
+		return errors.New("the plan doesn't record its source directory; pass --source")
+	}
+
+	var present, missing []string
+	for _, rel := range paths {
+		if _, err := os.Lstat(filepath.Join(source, rel)); err != nil {
+			fmt.Printf("skipped, not in source: %s\n", rel)
+			missing = append(missing, rel)
+			continue
+		}
+		present = append(present, rel)
+	}
+
+	// The scan defaults: files in the plan's order, symlinks recreated as
+	// symlinks
+	scan := ScanFlags{Order: "walk", Links: linksCopy}
+	s := newSession(&CopyCmd{Source: source, Destination: a.Destination, ScanFlags: scan, CopyFlags: a.CopyFlags})
+	s.paths = present
+	err = s.Run()
+
+	fmt.Fprintf(s.out, "Plan %s: %d files listed, %d copied, %d unchanged, %d not in source\n",
+		filepath.Base(a.Plan), len(paths), s.progress.Global.Files, s.progress.Skipped.Files, len(missing))
+	return err
+}
@@ -0,0 +1,14 @@
+package main
+
+import (
+	"os"
+	"syscall"
+	"time"
+)
+
+func fileAtime(fi os.FileInfo) time.Time {
+	if d, ok := fi.Sys().(*syscall.Win32FileAttributeData); ok {
+		return time.Unix(0, d.LastAccessTime.Nanoseconds())
+	}
+	return fi.ModTime()
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"unicode/utf8"
+)
+
+// tempName is where a copy of dst is written until it is complete, so an
+// interrupted run never leaves a truncated file under the real name.
+func tempName(dst string) string {
+	const suffix = ".splitcopy.tmp"
+	dir, name := filepath.Split(dst)
+	// Keep within the usual 255-byte name limit without splitting a character
+	if limit := 255 - len(suffix) - 1; len(name) > limit {
+		n := limit
+		for n > 0 && !utf8.RuneStart(name[n]) {
+			n--
+		}
+		name = name[:n]
+	}
+	return filepath.Join(dir, "."+name+suffix)
+}
+
+// writeNames returns the paths to write copies of dsts to: temporary names
+// in the same directories, or dsts themselves with --inplace.
+func (s *Session) writeNames(dsts []string) []string {
+	if s.args.Inplace {
+		return dsts
+	}
+	tmps := make([]string, len(dsts))
+	for i, dst := range dsts {
+		tmps[i] = tempName(dst)
+	}
+	return tmps
+}
+
+// commit renames each finished copy from its temporary name into place,
+// and with --fsync per-file makes the new name durable before the file is
+// reported done.
+func (s *Session) commit(tmps, dsts []string) error {
+	for i := range tmps {
+		if tmps[i] != dsts[i] {
+			if err := os.Rename(tmps[i], dsts[i]); err != nil {
+				return &destError{i, err}
+			}
+		}
+		if s.args.Fsync == fsyncFile {
+			if err := syncDir(filepath.Dir(dsts[i])); err != nil {
+				return &destError{i, err}
+			}
+		}
+	}
+	return nil
+}
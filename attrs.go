@@ -0,0 +1,98 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+)
+
+type RestoreAttrsCmd struct {
+	Manifest string `arg:"" help:"Manifest recording each file's metadata (JSON lines)." type:"existingfile"`
+	Tree     string `arg:"" help:"Existing tree to fix up." type:"existingdir"`
+}
+
+// Run re-applies the mode, owner, mtime, and xattrs recorded in a manifest
+// to files that are already in place, without touching their content.
+func (r *RestoreAttrsCmd) Run() error {
+	m, err := readManifest(r.Manifest, hashAlgs["sha256"])
+	if err != nil {
+		return err
+	}
+
+	paths := make([]string, 0, len(m))
+	for path := range m {
+		paths = append(paths, path)
+	}
+	slices.Sort(paths)
+
+	var restored, missing, failed int
+	for _, path := range paths {
+		err := restoreAttrs(filepath.Join(r.Tree, path), m[path])
+		switch {
+		case os.IsNotExist(err):
+			fmt.Printf("missing: %s\n", path)
+			missing++
+		case err != nil:
+			fmt.Printf("%v\n", err)
+			failed++
+		default:
+			restored++
+		}
+	}
+
+	fmt.Printf("Restored metadata on %d files\n", restored)
+	if missing > 0 || failed > 0 {
+		return fmt.Errorf("%d files missing, %d failed", missing, failed)
+	}
+	return nil
+}
+
+func restoreAttrs(dst string, e ManifestEntry) error {
+	info, err := os.Lstat(dst)
+	if err != nil {
+		return err
+	}
+
+	if e.UID != nil || e.GID != nil {
+		uid, gid := -1, -1
+		if e.UID != nil {
+			uid = *e.UID
+		}
+		if e.GID != nil {
+			gid = *e.GID
+		}
+		// Windows has no numeric owners to restore
+		if err := os.Lchown(dst, uid, gid); err != nil && !errors.Is(err, errors.ErrUnsupported) {
+			return err
+		}
+	}
+
+	for name, value := range e.Xattrs {
+		if err := lsetXattr(dst, name, value); err != nil {
+			return &os.PathError{Op: "setxattr " + name, Path: dst, Err: err}
+		}
+	}
+
+	// A symlink has no mode of its own, and os.Chtimes would follow it
+	if info.Mode()&os.ModeSymlink != 0 {
+		if e.Mtime == nil {
+			return nil
+		}
+		return lchtimes(dst, *e.Mtime, *e.Mtime)
+	}
+
+	mode := info.Mode()
+	if e.Mode != "" {
+		if mode, err = parseOctalMode(e.Mode); err != nil {
+			return fmt.Errorf("%s: %w", dst, err)
+		}
+	}
+	var mtime time.Time
+	if e.Mtime != nil {
+		mtime = *e.Mtime
+	}
+	return setMetadata(dst, mode, time.Time{}, mtime)
+}
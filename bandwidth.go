@@ -0,0 +1,87 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+const progressInterval = 320 * time.Millisecond
+
+// bandwidthReport writes a CSV throughput sample every progress interval.
+type bandwidthReport struct {
+	f         *os.File
+	w         *csv.Writer
+	start     time.Time
+	lastTime  time.Time
+	lastBytes int64
+}
+
+func newBandwidthReport(name string, start time.Time) (*bandwidthReport, error) {
+	f, err := os.Create(name)
+	if err != nil {
+		return nil, err
+	}
+	r := &bandwidthReport{f: f, w: csv.NewWriter(f), start: start, lastTime: start}
+	r.w.Write([]string{"time", "elapsed_seconds", "bytes_per_second", "total_bytes", "total_files", "disk"})
+	return r, nil
+}
+
+func (r *bandwidthReport) sample(now time.Time, p Progress) {
+	var rate float64
+	if dt := now.Sub(r.lastTime).Seconds(); dt > 0 {
+		rate = float64(p.Global.Bytes-r.lastBytes) / dt
+	}
+	r.lastTime, r.lastBytes = now, p.Global.Bytes
+
+	r.w.Write([]string{
+		now.Format(time.RFC3339Nano),
+		strconv.FormatFloat(now.Sub(r.start).Seconds(), 'f', 3, 64),
+		strconv.FormatFloat(rate, 'f', 0, 64),
+		strconv.FormatInt(p.Global.Bytes, 10),
+		strconv.FormatInt(p.Global.Files, 10),
+		strconv.Itoa(p.diskNum - 1),
+	})
+}
+
+func (r *bandwidthReport) close() error {
+	r.w.Flush()
+	if err := r.w.Error(); err != nil {
+		r.f.Close()
+		return err
+	}
+	return r.f.Close()
+}
+
+// recordBandwidth samples throughput until stop is closed, then writes a
+// final sample and closes the report.
+func (s *Session) recordBandwidth(stop <-chan struct{}) {
+	s.mu.Lock()
+	r, err := newBandwidthReport(s.args.BandwidthReport, s.progress.start)
+	s.mu.Unlock()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to write bandwidth report: %v\n", err)
+		return
+	}
+
+	ticker := time.NewTicker(progressInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case now := <-ticker.C:
+			s.mu.Lock()
+			r.sample(now, s.progress)
+			s.mu.Unlock()
+		case <-stop:
+			s.mu.Lock()
+			r.sample(time.Now(), s.progress)
+			s.mu.Unlock()
+			if err := r.close(); err != nil {
+				fmt.Fprintf(os.Stderr, "failed to write bandwidth report: %v\n", err)
+			}
+			return
+		}
+	}
+}
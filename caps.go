@@ -0,0 +1,148 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// destCaps records which of the metadata --preserve and --links ask for a
+// destination was found able to hold.
+type destCaps struct {
+	chown    bool
+	chtimes  bool
+	symlinks bool
+	xattrs   bool
+	mtime    time.Duration // timestamp resolution, 0 if unknown
+}
+
+var allCaps = destCaps{chown: true, chtimes: true, symlinks: true, xattrs: true}
+
+// probeCaps tries each kind of metadata the run keeps on a scratch file in
+// dest, and prints one warning listing what dest can't hold, which is then
+// left alone there instead of failing or warning file by file. A
+// destination that can't be probed is assumed to hold everything. The
+// caller must hold s.mu.
+func (s *Session) probeCaps(dest string) {
+	if dest == "" {
+		return
+	}
+	if _, ok := s.caps[filepath.Clean(dest)]; ok {
+		return
+	}
+	dir, _, err := existingParent(dest)
+	if err != nil {
+		return
+	}
+	f, err := os.CreateTemp(dir, ".splitcopy-caps-*")
+	if err != nil {
+		return
+	}
+	name := f.Name()
+	f.Close()
+	defer os.Remove(name)
+
+	caps := allCaps
+	var lost []string
+	if s.args.Preserve.Ownership {
+		caps.chown = canChown(name)
+		if !caps.chown {
+			lost = append(lost, "owners")
+		}
+	}
+	var coarse time.Duration
+	r, err := mtimeResolution(name)
+	if err == nil {
+		caps.mtime = r
+	}
+	if s.args.Preserve.Timestamps {
+		caps.chtimes = err == nil
+		if !caps.chtimes {
+			lost = append(lost, "timestamps")
+		} else if r >= 10*time.Millisecond {
+			coarse = r
+		}
+	}
+	if s.args.Links == linksCopy {
+		link := name + "-link"
+		caps.symlinks = os.Symlink(filepath.Base(name), link) == nil
+		_ = os.Remove(link)
+		if !caps.symlinks {
+			lost = append(lost, "symlinks")
+		}
+	}
+	if s.args.keepXattrs() {
+		err := setXattr(name, "user.splitcopy", []byte("1"))
+		caps.xattrs = err == nil || !isUnsupported(err)
+		if !caps.xattrs {
+			lost = append(lost, "xattrs")
+		}
+	}
+	s.caps[filepath.Clean(dest)] = caps
+
+	if len(lost) > 0 {
+		fmt.Fprintf(s.out, "Warning: %s can't hold %s, so they won't be preserved there\n", dest, joinOr(lost))
+	}
+	if coarse > 0 {
+		fmt.Fprintf(s.out, "Note: %s only keeps mtimes to %v\n", dest, coarse)
+	}
+}
+
+// guessCaps stands in for probeCaps under --dry-run, which mustn't write
+// to dest: it assumes dest can hold everything, and takes its timestamp
+// resolution from the type of filesystem. The caller must hold s.mu.
+func (s *Session) guessCaps(dest string) {
+	if dest == "" {
+		return
+	}
+	caps := allCaps
+	caps.mtime = fsMtimeResolution(dest)
+	s.caps[filepath.Clean(dest)] = caps
+}
+
+// canChown reports whether the file name's owner can be changed. As root
+// it tries to give the file away, which filesystems without owners of
+// their own, such as FAT, refuse. Anyone else can at most keep their own.
+func canChown(name string) bool {
+	info, err := os.Lstat(name)
+	if err != nil {
+		return true
+	}
+	uid, gid, ok := fileOwner(info)
+	if !ok {
+		return true // no numeric owners to copy in the first place
+	}
+	if os.Geteuid() == 0 {
+		uid, gid = 65534, 65534 // nobody
+	}
+	return os.Lchown(name, uid, gid) == nil
+}
+
+// capsOf returns what the destination that path is written under can
+// hold. The longest matching destination wins, for one nested in another.
+func (s *Session) capsOf(path string) destCaps {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	caps, best := allCaps, -1
+	for root, c := range s.caps {
+		rel, err := filepath.Rel(root, path)
+		inside := err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+		if inside && len(root) > best {
+			caps, best = c, len(root)
+		}
+	}
+	return caps
+}
+
+// joinOr joins items as "a", "a or b", or "a, b, or c".
+func joinOr(items []string) string {
+	switch len(items) {
+	case 1:
+		return items[0]
+	case 2:
+		return items[0] + " or " + items[1]
+	}
+	return strings.Join(items[:len(items)-1], ", ") + ", or " + items[len(items)-1]
+}
@@ -0,0 +1,314 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"syscall"
+	"time"
+)
+
+const (
+	chunkSuffix = ".chunks"
+
+	// minChunk is the smallest part worth writing; a destination with less
+	// room than this is swapped out instead.
+	minChunk = 1 << 20
+
+	// chunkMapRoom is left free on each destination for the chunk map.
+	chunkMapRoom = 64 << 10
+)
+
+// chunkPart is one piece of a file split across destinations by --chunk.
+type chunkPart struct {
+	Name   string `json:"name"` // in the same directory as the map
+	Disk   int    `json:"disk"`
+	Offset int64  `json:"offset"`
+	Size   int64  `json:"size"`
+	Sum    string `json:"sum"`
+}
+
+// chunkMap records how to put a split file back together with splitcopy
+// join. It is saved as NAME.chunks next to the last part.
+type chunkMap struct {
+	Name  string      `json:"name"`
+	Dir   string      `json:"dir"` // relative to each destination root
+	Size  int64       `json:"size"`
+	Mode  string      `json:"mode"`
+	Mtime time.Time   `json:"mtime"`
+	Hash  string      `json:"hash"`
+	Parts []chunkPart `json:"parts"`
+}
+
+// chunks reports whether a file that won't fit should be split with
+// --chunk rather than moved to the next destination whole.
+func (s *Session) chunks(full error, info os.FileInfo) bool {
+	var de *destError
+	return s.args.Chunk && errors.Is(full, errWontFit) && errors.As(full, &de) && de.dest == 0 && info.Mode().IsRegular()
+}
+
+// copyChunks writes a file that doesn't fit in the space left on the
+// destination as parts NAME.part001, NAME.part002, ..., filling each
+// destination in turn and asking for the next one in between.
+func (s *Session) copyChunks(job copyJob, src, dstRel string, sInfo os.FileInfo) error {
+	started := time.Now()
+	defer s.fds.release(s.fds.acquire(2))
+
+	in, err := os.Open(src)
+	if err != nil {
+		return s.chunkFailed(job, chunkMap{}, err)
+	}
+	defer in.Close()
+	r := s.sourceReader(in, nil)
+	defer func() { s.partialBytes.Add(-r.n) }()
+
+	m := chunkMap{
+		Name:  filepath.Base(dstRel),
+		Dir:   filepath.ToSlash(filepath.Dir(dstRel)),
+		Size:  sInfo.Size(),
+		Mode:  fmt.Sprintf("%04o", sInfo.Mode().Perm()),
+		Mtime: sInfo.ModTime(),
+		Hash:  s.hash.name,
+	}
+	var off int64
+	var dest string
+	var attempt int // --retries used
+	var full int    // ENOSPC with room left on this destination
+	var writing bool
+	endWrite := func() {
+		if writing {
+			s.endWrite()
+			writing = false
+		}
+	}
+	defer endWrite()
+	for off < m.Size {
+		if s.interrupted.Load() {
+			return errInterrupted
+		}
+		s.mu.Lock()
+		var gen, disk int
+		dest, gen, disk = s.args.Destination, s.destGen, s.progress.diskNum-1
+		s.mu.Unlock()
+		if !s.beginWrite(gen) {
+			continue
+		}
+		writing = true
+
+		room := s.chunkRoom(dest)
+		if room < min(minChunk, m.Size-off) {
+			endWrite()
+			if err := s.swapDestination(&destError{0, errWontFit}, gen); err != nil {
+				return err
+			}
+			continue
+		}
+
+		part := chunkPart{Name: fmt.Sprintf("%s.part%03d", m.Name, len(m.Parts)+1), Disk: disk, Offset: off, Size: min(room, m.Size-off)}
+		partRel := filepath.Join(filepath.Dir(dstRel), part.Name)
+		if _, err := in.Seek(off, io.SeekStart); err != nil {
+			return s.chunkFailed(job, m, err)
+		}
+		sum, err := s.copyChunk(r, filepath.Join(dest, partRel), part.Size, sInfo)
+		var de *destError
+		if errors.Is(err, errInterrupted) {
+			return err
+		} else if errors.Is(err, errVerifyFailed) {
+			// Not marked done, so the file stays in the remaining list
+			s.removeChunks(job.rel, m)
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			fmt.Fprintln(s.out)
+			fmt.Fprintf(s.out, "%s: %v\n", job.rel, err)
+			s.progress.Errors++
+			s.progress.VerifyFailed++
+			s.emit(Event{Type: EventMismatch, Path: job.rel, Detail: err.Error()})
+			return nil
+		} else if err != nil && s.retry(job.rel, err, &attempt) {
+			endWrite()
+			continue
+		} else if errors.As(err, &de) && isNoSpace(err) && full == 0 {
+			full++
+			endWrite()
+			continue // other workers used the room; measure it again
+		} else if errors.As(err, &de) {
+			full = 0
+			endWrite()
+			if err := s.swapDestination(err, gen); err != nil {
+				return err
+			}
+			continue
+		} else if err != nil {
+			return s.chunkFailed(job, m, err)
+		}
+
+		part.Sum = hex.EncodeToString(sum)
+		m.Parts = append(m.Parts, part)
+		off += part.Size
+		s.mu.Lock()
+		s.progress.Local.Files++
+		s.progress.Local.Bytes += part.Size
+		s.placed = append(s.placed, placement{rel: job.rel, dstRel: partRel, dest: dest, sum: sum, written: sum})
+		s.mu.Unlock()
+
+		if off < m.Size {
+			full = 0
+			endWrite()
+			next := fmt.Errorf("%w: %s continues on the next destination", syscall.ENOSPC, job.rel)
+			if err := s.swapDestination(&destError{0, next}, gen); err != nil {
+				return err
+			}
+		}
+	}
+
+	r.nocache.finish()
+	s.saveChunkMap(filepath.Join(dest, dstRel+chunkSuffix), m)
+	removeErr := s.removeSource(src)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if removeErr != nil {
+		fmt.Fprintf(s.out, "\r%v\033[K\n", removeErr)
+		s.progress.Errors++
+		s.emit(Event{Type: EventError, Path: job.rel, Detail: removeErr.Error()})
+	}
+	took := time.Since(started)
+	s.timings.record(job.rel, m.Size, took)
+	fmt.Fprintf(s.out, "\rchunked: %s: %d parts\033[K\n", job.rel, len(m.Parts))
+	s.progress.Chunked.Files++
+	s.progress.Chunked.Bytes += m.Size
+	s.progress.ChunkParts += int64(len(m.Parts))
+	s.progress.Global.Files++
+	s.progress.Global.Bytes += m.Size
+	s.emit(Event{Type: EventCopied, Path: job.rel, Bytes: m.Size, Detail: dest, Duration: took})
+	s.done[job.index] = true
+	return nil
+}
+
+// chunkRoom is how much of a file fits on dest, in whole blocks, keeping
+// room for the chunk map.
+func (s *Session) chunkRoom(dest string) int64 {
+	avail, block, err := s.usableSpace(dest)
+	if err != nil || avail <= chunkMapRoom {
+		return 0
+	}
+	block = max(block, 1)
+	return (int64(avail) - chunkMapRoom) / block * block
+}
+
+// copyChunk writes the next size bytes of r to dst and returns their hash.
+func (s *Session) copyChunk(r io.Reader, dst string, size int64, sInfo os.FileInfo) (sum []byte, err error) {
+	if err := s.mkdirAll(filepath.Dir(dst)); err != nil {
+		return nil, &destError{0, err}
+	}
+	tmp := s.writeNames([]string{dst})[0]
+	out, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, s.fileMode(sInfo.Mode()).Perm())
+	if err != nil {
+		return nil, &destError{0, err}
+	}
+	f := destFile{out, 0}
+	defer func() {
+		if f.File != nil {
+			f.Close()
+		}
+		if err != nil {
+			_ = os.Remove(tmp)
+		}
+	}()
+
+	if err := preallocate(out, size); err != nil {
+		return nil, &destError{0, err}
+	}
+	h := newAsyncHash(s.hash.new())
+	defer h.close()
+	n, err := copyPipelined(io.MultiWriter(f, h), io.LimitReader(r, size), s.copyBuffer())
+	if err != nil {
+		return nil, err
+	} else if n < size {
+		return nil, io.ErrUnexpectedEOF
+	}
+	if s.args.NoCache {
+		dropPages(out, true)
+	}
+	if err = s.syncFile(f); err != nil {
+		return nil, err
+	}
+	err = f.File.Close()
+	f.File = nil
+	if err != nil {
+		return nil, &destError{0, err}
+	}
+	if err = s.preserveMetadata(tmp, sInfo); err != nil {
+		return nil, &destError{0, err}
+	}
+
+	sum = h.Sum(nil)
+	if s.args.Verify {
+		if err = s.hash.verifyWritten(tmp, sum); err != nil {
+			return nil, err
+		}
+	}
+	if err = s.commit([]string{tmp}, []string{dst}); err != nil {
+		return nil, err
+	}
+	return sum, nil
+}
+
+// chunkFailed records a file whose source couldn't be read while it was
+// being split, and removes the parts already written.
+func (s *Session) chunkFailed(job copyJob, m chunkMap, err error) error {
+	s.removeChunks(job.rel, m)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fmt.Fprintln(s.out)
+	fmt.Fprintf(s.out, "%s: %v\n", job.rel, err)
+	s.progress.Errors++
+	s.emit(Event{Type: EventError, Path: job.rel, Detail: err.Error()})
+	s.placed = append(s.placed, placement{rel: job.rel})
+	s.done[job.index] = true
+	return nil
+}
+
+// removeChunks deletes the parts of a split that won't be finished and
+// forgets that they were placed. Parts on destinations that have since
+// been swapped out can't be reached and are left where they are.
+func (s *Session) removeChunks(rel string, m chunkMap) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	dest, disk := s.args.Destination, s.progress.diskNum-1
+	for _, part := range m.Parts {
+		if part.Disk != disk {
+			continue
+		}
+		if os.Remove(filepath.Join(dest, filepath.FromSlash(m.Dir), part.Name)) == nil {
+			s.progress.Local.Files--
+			s.progress.Local.Bytes -= part.Size
+		}
+	}
+	s.placed = slices.DeleteFunc(s.placed, func(p placement) bool { return p.rel == rel })
+}
+
+// saveChunkMap writes the map next to the last part, or to the working
+// directory if that fails.
+func (s *Session) saveChunkMap(name string, m chunkMap) {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err == nil {
+		data = append(data, '\n')
+		err = os.WriteFile(name, data, 0o644)
+	}
+	if err != nil {
+		fallback := m.Name + chunkSuffix
+		fmt.Fprintf(s.out, "\rfailed to write %s: %v\033[K\n", name, err)
+		if err := os.WriteFile(fallback, data, 0o644); err != nil {
+			fmt.Fprintf(s.out, "failed to write %s: %v\n", fallback, err)
+			return
+		}
+		name = fallback
+	}
+	fmt.Fprintf(s.out, "\rChunk map saved to: %s\033[K\n", name)
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// errNoClone means a destination can't share blocks with the source, most
+// often because it is a different filesystem or not copy-on-write.
+var errNoClone = errors.New("can't clone")
+
+// cloneFile makes each of dsts a reflink of src, which costs no space or
+// time on btrfs, XFS, and APFS. If any destination can't take a clone, the
+// ones made so far are removed and errNoClone is returned so the caller
+// can copy normally.
+func (s *Session) cloneFile(src *os.File, dsts []string, sInfo os.FileInfo) error {
+	for i, dst := range dsts {
+		if err := s.mkdirAll(filepath.Dir(dst)); err != nil {
+			return &destError{i, err}
+		}
+		if err := clone(src, dst, s.fileMode(sInfo.Mode()).Perm()); err != nil {
+			for _, made := range dsts[:i+1] {
+				_ = os.Remove(made)
+			}
+			return fmt.Errorf("%w: %s: %v", errNoClone, dst, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,14 @@
+package main
+
+import (
+	"io/fs"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// clone uses clonefile on APFS, which needs dst not to exist yet.
+func clone(src *os.File, dst string, perm fs.FileMode) error {
+	_ = os.Remove(dst)
+	return unix.Clonefile(src.Name(), dst, unix.CLONE_NOFOLLOW)
+}
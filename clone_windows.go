@@ -0,0 +1,13 @@
+package main
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+)
+
+// clone isn't available on Windows: ReFS block cloning only works within
+// one volume through FSCTL_DUPLICATE_EXTENTS_TO_FILE, which isn't used.
+func clone(src *os.File, dst string, perm fs.FileMode) error {
+	return errors.ErrUnsupported
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/alecthomas/kong"
+	"github.com/ergochat/readline"
+)
+
+// Threshold is either an absolute count ("100") or a percentage ("10%").
+type Threshold struct {
+	Count   int
+	Percent float64
+	Set     bool
+}
+
+func (t *Threshold) Decode(ctx *kong.DecodeContext) error {
+	var value string
+	if err := ctx.Scan.PopValueInto("threshold", &value); err != nil {
+		return err
+	}
+
+	if pct, ok := strings.CutSuffix(value, "%"); ok {
+		f, err := strconv.ParseFloat(pct, 64)
+		if err != nil || f < 0 || f > 100 {
+			return fmt.Errorf("invalid percentage %q", value)
+		}
+		*t = Threshold{Percent: f, Set: true}
+		return nil
+	}
+
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		return fmt.Errorf("invalid count %q", value)
+	}
+	*t = Threshold{Count: n, Set: true}
+	return nil
+}
+
+func (t Threshold) exceeded(n, total int) bool {
+	if !t.Set {
+		return false
+	}
+	if t.Percent > 0 {
+		return total > 0 && float64(n)*100/float64(total) > t.Percent
+	}
+	return n > t.Count
+}
+
+// confirmOverwrites waits for the scan to finish and asks before copying
+// if too many destination files already exist, which usually means the
+// destination was mistyped.
+func (s *Session) confirmOverwrites(startIndex int) error {
+	if !s.args.ConfirmOverwriteThreshold.Set || s.args.Yes || s.args.OnConflict != conflictOverwrite {
+		return nil
+	}
+
+	select {
+	case <-s.scanDone:
+	case <-s.sigIntChan:
+		return s.exitWithRemaining(startIndex)
+	}
+
+	var existing int
+	paths := s.allPaths[min(startIndex, len(s.allPaths)):]
+	for _, rel := range paths {
+		if _, err := os.Lstat(filepath.Join(s.args.Destination, s.args.destName(rel)+s.args.PipeSuffix)); err == nil {
+			existing++
+		}
+	}
+	if !s.args.ConfirmOverwriteThreshold.exceeded(existing, len(paths)) {
+		return nil
+	}
+
+	fmt.Fprintf(s.out, "%d of %d files already exist in %s and would be overwritten.\n", existing, len(paths), s.args.Destination)
+	ok, err := promptYesNo("Continue?")
+	if err != nil || !ok {
+		return fmt.Errorf("aborted: refusing to overwrite %d existing files", existing)
+	}
+	return nil
+}
+
+func promptYesNo(question string) (bool, error) {
+	rl, err := readline.NewEx(&readline.Config{Prompt: question + " [y/N] "})
+	if err != nil {
+		return false, err
+	}
+	defer rl.Close()
+
+	input, err := rl.ReadLine()
+	if err != nil {
+		return false, err
+	}
+	answer := strings.ToLower(strings.TrimSpace(input))
+	return answer == "y" || answer == "yes", nil
+}
@@ -0,0 +1,42 @@
+package main
+
+import "testing"
+
+func TestThreshold(t *testing.T) {
+	tests := []struct {
+		in       string
+		want     Threshold
+		n, total int
+		exceeded bool
+	}{
+		{"100", Threshold{Count: 100, Set: true}, 101, 1000, true},
+		{"100", Threshold{Count: 100, Set: true}, 100, 1000, false},
+		{"0", Threshold{Set: true}, 1, 1, true},
+		{"10%", Threshold{Percent: 10, Set: true}, 11, 100, true},
+		{"10%", Threshold{Percent: 10, Set: true}, 10, 100, false},
+		{"2.5%", Threshold{Percent: 2.5, Set: true}, 3, 100, true},
+		{"100%", Threshold{Percent: 100, Set: true}, 100, 100, false},
+	}
+	for _, tt := range tests {
+		th, err := parseFlag[Threshold](t, tt.in)
+		if err != nil {
+			t.Errorf("--threshold %s: %v", tt.in, err)
+			continue
+		}
+		if th != tt.want {
+			t.Errorf("--threshold %s = %+v, want %+v", tt.in, th, tt.want)
+		}
+		if got := th.exceeded(tt.n, tt.total); got != tt.exceeded {
+			t.Errorf("--threshold %s: exceeded(%d, %d) = %v, want %v", tt.in, tt.n, tt.total, got, tt.exceeded)
+		}
+	}
+
+	if (Threshold{}).exceeded(1000, 1000) {
+		t.Error("an unset threshold was exceeded")
+	}
+	for _, in := range []string{"", "-1", "ten", "101%", "-5%", "%"} {
+		if got, err := parseFlag[Threshold](t, in); err == nil {
+			t.Errorf("--threshold %q = %+v, want an error", in, got)
+		}
+	}
+}
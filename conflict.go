@@ -0,0 +1,226 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ergochat/readline"
+)
+
+// What to do with a file whose destination path already exists
+const (
+	conflictOverwrite = "overwrite"
+	conflictSkip      = "skip"
+	conflictRename    = "rename"
+	conflictPrompt    = "prompt"
+	conflictError     = "error"
+)
+
+// claimName reserves dstRel for rel for the rest of the run. With
+// --rename-collisions, a name another source file already took, on any
+// destination, gets a " (N)" suffix instead of being overwritten. Without
+// it, only names that --sanitize or --normalize map onto another source
+// file's, or that differ from it in nothing but case once a destination
+// is case-insensitive, are caught and reported as a clash for
+// resolveConflict.
+func (s *Session) claimName(rel, dstRel string) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	renamesNames := s.args.Sanitize || s.args.Normalize != "none"
+	if !s.args.RenameCollisions && !s.foldCase && !renamesNames {
+		return dstRel, false
+	}
+
+	if !s.args.RenameCollisions {
+		if s.takenBy(dstRel, rel) {
+			owner := s.claimed[s.claimKey(dstRel)]
+			if s.args.destName(owner) == s.args.destName(rel) {
+				fmt.Fprintf(s.out, "\r%s: gets the same name on the destination as %s\033[K\n", rel, owner)
+			} else {
+				fmt.Fprintf(s.out, "\r%s: only differs in case from %s, which the destination treats as the same name\033[K\n", rel, owner)
+			}
+			return dstRel, true
+		}
+		s.claimed[s.claimKey(dstRel)] = rel
+		return dstRel, false
+	}
+
+	name := dstRel
+	for n := 1; s.takenBy(name, rel); n++ {
+		name = numbered(dstRel, n)
+	}
+	s.claimed[s.claimKey(name)] = rel
+	if name != dstRel {
+		s.emit(Event{Type: EventRenamed, Path: rel, Detail: name})
+	}
+	return name, false
+}
+
+// takenBy reports whether a source file other than rel has claimed
+// dstRel. The caller must hold s.mu.
+func (s *Session) takenBy(dstRel, rel string) bool {
+	owner := s.claimed[s.claimKey(dstRel)]
+	return owner != "" && owner != rel
+}
+
+// claimKey is the key a destination name is claimed under: folded to
+// lower case once a case-insensitive destination is in use, where Foo.txt
+// and foo.txt are the same file. The caller must hold s.mu.
+func (s *Session) claimKey(dstRel string) string {
+	if s.foldCase {
+		return strings.ToLower(dstRel)
+	}
+	return dstRel
+}
+
+// checkCase probes whether dest tells names apart by case, and from the
+// first one that doesn't on, claims names case-insensitively. The caller
+// must hold s.mu.
+func (s *Session) checkCase(dest string) {
+	if dest == "" || s.foldCase {
+		return
+	}
+	dir, _, err := existingParent(dest)
+	if err != nil || !caseInsensitive(dir) {
+		return
+	}
+	s.foldCase = true
+	claimed := make(map[string]string, len(s.claimed))
+	for name, rel := range s.claimed {
+		claimed[strings.ToLower(name)] = rel
+	}
+	s.claimed = claimed
+}
+
+// caseInsensitive creates a scratch file in dir and reports whether it can
+// also be found under its name in upper case, as on NTFS, FAT, exFAT, and
+// APFS or HFS+ by default.
+func caseInsensitive(dir string) bool {
+	f, err := os.CreateTemp(dir, ".splitcopy-case-*")
+	if err != nil {
+		return false
+	}
+	name := f.Name()
+	f.Close()
+	defer os.Remove(name)
+
+	_, err = os.Lstat(filepath.Join(dir, strings.ToUpper(filepath.Base(name))))
+	return err == nil
+}
+
+// resolveConflict applies --on-conflict when dstRel already exists on one
+// of dests, or clashes with the destination name of another source file. A clash is renamed rather than
+// overwritten, since the file it would replace was copied in this run. It
+// returns the destination name to write, which differs from dstRel after
+// a rename, and the action taken.
+func (s *Session) resolveConflict(rel, dstRel string, clash bool, sInfo os.FileInfo, dests []string) (string, string) {
+	policy := s.args.OnConflict
+	switch {
+	case clash && policy == conflictOverwrite:
+		policy = conflictRename
+	case clash:
+	case policy == conflictOverwrite:
+		return dstRel, conflictOverwrite
+	case !existsOn(dests, dstRel):
+		return dstRel, ""
+	}
+
+	if policy == conflictPrompt {
+		if s.args.DryRun {
+			return dstRel, conflictPrompt // nothing to decide yet
+		}
+		policy = s.promptConflict(dstRel, sInfo, dests)
+	}
+	if policy == conflictRename {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		name := dstRel
+		for n := 1; s.takenBy(name, rel) || existsOn(dests, name); n++ {
+			name = numbered(dstRel, n)
+		}
+		s.claimed[s.claimKey(name)] = rel
+		s.emit(Event{Type: EventRenamed, Path: rel, Detail: name})
+		return name, conflictRename
+	}
+	return dstRel, policy
+}
+
+func existsOn(dests []string, rel string) bool {
+	for _, dest := range dests {
+		if dest == "" {
+			continue
+		}
+		if _, err := os.Lstat(filepath.Join(dest, rel)); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// numbered turns "dir/name.ext" into "dir/name (n).ext".
+func numbered(rel string, n int) string {
+	dir, base := filepath.Split(rel)
+	ext := filepath.Ext(base)
+	stem := strings.TrimSuffix(base, ext)
+	return filepath.Join(dir, fmt.Sprintf("%s (%d)%s", stem, n, ext))
+}
+
+// promptConflict asks what to do with an existing destination file,
+// showing both copies. An answer ending in "a" (or " all") is used without
+// asking for the rest of the run. Workers take turns, and don't prompt
+// while a destination is being swapped.
+func (s *Session) promptConflict(dstRel string, sInfo os.FileInfo, dests []string) string {
+	s.swapMu.Lock()
+	defer s.swapMu.Unlock()
+	if s.conflictAll != "" {
+		return s.conflictAll
+	}
+
+	s.mu.Lock()
+	s.prompting = true
+	fmt.Fprintf(s.out, "\r%s already exists at the destination:\033[K\n", dstRel)
+	fmt.Fprintf(s.out, "  source:      %10s  %s\n", humanBytes(sInfo.Size()), sInfo.ModTime().Format(time.DateTime))
+	for _, dest := range dests {
+		if info, err := os.Lstat(filepath.Join(dest, dstRel)); dest != "" && err == nil {
+			fmt.Fprintf(s.out, "  destination: %10s  %s  %s\n", humanBytes(info.Size()), info.ModTime().Format(time.DateTime), dest)
+		}
+	}
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		s.prompting = false
+		s.mu.Unlock()
+	}()
+
+	rl, err := readline.NewEx(&readline.Config{Prompt: `[o]verwrite, [s]kip, [r]ename (add "a" for all, e.g. "sa")? `})
+	if err != nil {
+		return conflictSkip
+	}
+	defer rl.Close()
+
+	actions := map[string]string{"o": conflictOverwrite, "s": conflictSkip, "r": conflictRename}
+	for {
+		input, err := rl.ReadLine()
+		if err != nil {
+			return conflictSkip
+		}
+		answer := strings.ToLower(strings.TrimSpace(input))
+		all := false
+		if rest, ok := strings.CutSuffix(answer, "all"); ok && len(rest) > 0 {
+			answer, all = strings.TrimSpace(rest), true
+		} else if rest, ok := strings.CutSuffix(answer, "a"); ok && len(rest) > 0 {
+			answer, all = rest, true
+		}
+		action, ok := actions[answer]
+		if !ok {
+			continue
+		}
+		if all {
+			s.conflictAll = action
+		}
+		return action
+	}
+}
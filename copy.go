@@ -0,0 +1,547 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+type copyResult struct {
+	holes     int
+	holeBytes int64
+	sum       []byte   // hash of the written bytes when they differ from the source
+	written   []byte   // hash of the written bytes, when --verify or --sums needs it
+	lost      []string // streams the destination couldn't hold
+	lostAttrs []string // xattrs the destination couldn't hold
+	lostACL   bool
+	cloned    bool   // shares the source's blocks instead of a copy of them
+	damaged   []span // unreadable source ranges written as zeros by --salvage
+}
+
+// destError marks a failure on one of the destinations being written so the
+// caller knows which disk needs attention.
+type destError struct {
+	dest int
+	err  error
+}
+
+func (e *destError) Error() string { return e.err.Error() }
+func (e *destError) Unwrap() error { return e.err }
+
+type destFile struct {
+	*os.File
+	dest int
+}
+
+func (f destFile) Write(p []byte) (int, error) {
+	n, err := f.File.Write(p)
+	if err != nil {
+		err = &destError{f.dest, err}
+	}
+	return n, err
+}
+
+func (f destFile) Seek(offset int64, whence int) (int64, error) {
+	n, err := f.File.Seek(offset, whence)
+	if err != nil {
+		err = &destError{f.dest, err}
+	}
+	return n, err
+}
+
+func (f destFile) Truncate(size int64) error {
+	if err := f.File.Truncate(size); err != nil {
+		return &destError{f.dest, err}
+	}
+	return nil
+}
+
+// copyFile reads src once and writes the same bytes to every path in dsts.
+func (s *Session) copyFile(src string, dsts []string, watch *stallWatch) (res copyResult, err error) {
+	// The source, each destination, and the filter's stdio pipes
+	handles := 1 + len(dsts)
+	if s.args.PipeThrough != "" {
+		handles += 3
+	}
+	defer s.fds.release(s.fds.acquire(handles))
+
+	in, err := os.Open(src)
+	if err != nil {
+		return res, err
+	}
+	defer in.Close()
+
+	sInfo, err := in.Stat()
+	if err != nil {
+		return res, err
+	}
+	if s.sequentialRead {
+		adviseSequential(in)
+	}
+
+	if s.args.Partial && len(dsts) == 1 && s.args.PipeThrough == "" {
+		if res, ok, err := s.resumePartial(in, src, dsts[0], sInfo, watch); ok {
+			return res, err
+		}
+	}
+
+	tmps := s.writeNames(dsts)
+	if s.args.Reflink != "never" && s.args.PipeThrough == "" {
+		err = s.cloneFile(in, tmps, sInfo)
+		if err == nil && !watch.finishing() {
+			err = errStalled
+		} else if err == nil {
+			res.cloned = true
+			if s.args.Verify || s.args.Sums {
+				res.written, err = s.hash.file(src)
+			}
+			if err == nil {
+				err = s.finishCopy(src, tmps, sInfo, &res)
+			}
+			if err == nil {
+				err = s.commit(tmps, dsts)
+			}
+			if err != nil {
+				for _, tmp := range tmps {
+					_ = os.Remove(tmp)
+				}
+			}
+			return res, err
+		} else if !errors.Is(err, errNoClone) || s.args.Reflink == "always" {
+			return res, err
+		}
+		err = nil
+	}
+
+	outs := make([]destFile, 0, len(dsts))
+	defer func() {
+		for _, out := range outs {
+			if out.File != nil {
+				out.Close()
+			}
+		}
+		// An abandoned copy may already be running again under the same names
+		if err != nil && !errors.Is(err, errStalled) {
+			for i, tmp := range tmps {
+				if s.keepsPartial(dsts, err) && keepPartial(tmp, dsts[i]) {
+					continue
+				}
+				_ = os.Remove(tmp)
+			}
+		}
+	}()
+
+	prealloc := s.preallocates(sInfo)
+	unnamed := make([]bool, len(tmps)) // opened with O_TMPFILE, linked once written
+	for i, dst := range tmps {
+		if err := s.mkdirAll(filepath.Dir(dst)); err != nil {
+			return res, &destError{i, err}
+		}
+		perm := s.fileMode(sInfo.Mode()).Perm()
+		var out *os.File
+		if !s.args.Inplace && !s.args.Partial {
+			out, err = openTmpfile(filepath.Dir(dst), dst, perm)
+			unnamed[i] = err == nil
+		}
+		if !unnamed[i] {
+			out, err = os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+		}
+		if err != nil {
+			return res, &destError{i, err}
+		}
+		outs = append(outs, destFile{out, i})
+		if prealloc {
+			if err := preallocate(out, sInfo.Size()); err != nil {
+				return res, &destError{i, err}
+			}
+		}
+	}
+
+	r := s.sourceReader(in, outs)
+	r.watch = watch
+	defer func() { s.partialBytes.Add(-r.n) }()
+	var salvage *salvageReader
+	if s.args.Salvage {
+		salvage = &salvageReader{f: in, size: sInfo.Size(), block: int64(s.args.SalvageBlock)}
+		r.r = salvage
+	}
+
+	// Hash the source as it is read so --verify and --sums don't read it
+	// twice, on the side so the hash doesn't hold up the copy
+	var sum hash.Hash
+	var reader io.Reader = r
+	if (s.args.Verify || s.args.Sums) && s.args.PipeThrough == "" {
+		h := newAsyncHash(s.hash.new())
+		defer h.close()
+		sum = h
+		reader = io.TeeReader(r, sum)
+	}
+	switch {
+	case s.args.PipeThrough != "":
+		res.sum, err = pipeThrough(s.args.PipeThrough, r, multiWriter(outs), s.hash)
+	case s.args.Direct:
+		err = copyDirect(outs, in, reader, s.directBuffer())
+	case s.args.Engine == "uring" && salvage == nil && s.dense(sInfo):
+		err = s.copyUring(in, outs, r, sum, sInfo.Size())
+	case s.args.Sparse != "never" && sInfo.Size() >= int64(s.args.SparseMinSize):
+		res, err = copySparse(outs, in, reader, sInfo.Size(), s.copyBuffer(), sum, s.args.Sparse == "always")
+	default:
+		_, err = copyData(outs, reader, -1, s.copyBuffer())
+	}
+	if err != nil {
+		return res, err
+	} else if !watch.finishing() {
+		return res, errStalled
+	}
+	r.nocache.finish()
+	if salvage != nil {
+		res.damaged = salvage.damaged
+	}
+	res.written = res.sum
+	if sum != nil {
+		res.written = sum.Sum(nil)
+	}
+
+	for i := range outs {
+		if err = s.syncFile(outs[i]); err != nil {
+			return res, err
+		}
+		if unnamed[i] {
+			if err = linkTmpfile(outs[i].File, tmps[i]); err != nil {
+				return res, &destError{i, err}
+			}
+		}
+		err = outs[i].Close()
+		outs[i].File = nil
+		if err != nil {
+			return res, &destError{i, err}
+		}
+	}
+	if err = s.finishCopy(src, tmps, sInfo, &res); err != nil {
+		return res, err
+	}
+	err = s.commit(tmps, dsts)
+	return res, err
+}
+
+// finishCopy applies the source's metadata to each written copy and reads
+// them back for --verify.
+func (s *Session) finishCopy(src string, dsts []string, sInfo os.FileInfo, res *copyResult) error {
+	for i := range dsts {
+		if err := s.preserveMetadata(dsts[i], sInfo); err != nil {
+			return &destError{i, err}
+		}
+		if s.args.Streams {
+			lost, err := copyStreams(src, dsts[i])
+			if err != nil {
+				return &destError{i, err}
+			}
+			res.lost = append(res.lost, lost...)
+		}
+		if s.args.MacMetadata {
+			lost, err := copyMacMetadata(src, dsts[i])
+			if err != nil {
+				return &destError{i, err}
+			}
+			res.lostAttrs = append(res.lostAttrs, lost...)
+		} else if s.args.keepXattrs() && s.capsOf(dsts[i]).xattrs {
+			lost, err := copyXattrs(src, dsts[i])
+			if err != nil {
+				return &destError{i, err}
+			}
+			res.lostAttrs = append(res.lostAttrs, lost...)
+		}
+		if s.args.keepACLs() {
+			// After preserveMetadata: chmod would reset the ACL's mask
+			ok, err := copyACL(src, dsts[i])
+			if err != nil {
+				return &destError{i, err}
+			}
+			res.lostACL = res.lostACL || !ok
+		}
+	}
+
+	if s.args.Verify {
+		for _, dst := range dsts {
+			if err := s.hash.verifyWritten(dst, res.written); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// interruptReader aborts an in-progress copy once the session is stopping
+// so an interrupted worker doesn't have to finish a huge file first. It
+// also counts bytes read so progress moves during large files.
+type interruptReader struct {
+	r       io.Reader
+	stop    *atomic.Bool
+	count   *atomic.Int64
+	n       int64
+	limit   *rateLimiter
+	nocache *cacheDropper
+	watch   *stallWatch
+}
+
+// sourceReader reads in for a copy to outs, counting progress and
+// applying --bwlimit and --no-cache.
+func (s *Session) sourceReader(in *os.File, outs []destFile) *interruptReader {
+	return &interruptReader{r: in, stop: &s.interrupted, count: &s.partialBytes, limit: s.limiter, nocache: s.cacheDropper(in, outs)}
+}
+
+func (r *interruptReader) Read(p []byte) (int, error) {
+	if r.stop.Load() {
+		return 0, errInterrupted
+	} else if r.watch.abandoned() {
+		return 0, errStalled
+	}
+	if r.limit != nil {
+		p = p[:min(int64(len(p)), r.limit.burst())]
+	}
+	n, err := r.r.Read(p)
+	r.n += int64(n)
+	r.count.Add(int64(n))
+	r.watch.touch()
+	r.nocache.copied(int64(n))
+	if !r.limit.wait(int64(n), r.stop) && err == nil {
+		err = errInterrupted
+	}
+	return n, err
+}
+
+// errNoCopyRange means copyRange can't be used between these files.
+var errNoCopyRange = errors.New("copy_file_range not supported")
+
+// copyData copies n bytes from r, or all of it if n is negative, to dsts.
+// With a single destination and nothing else reading along (r isn't
+// teed into a hash), the copy is done in the kernel with copyRange.
+func copyData(dsts []destFile, r io.Reader, n int64, buf []byte) (int64, error) {
+	if ir, ok := r.(*interruptReader); ok && len(dsts) == 1 {
+		m, err := ir.copyRange(dsts[0], n)
+		if !errors.Is(err, errNoCopyRange) {
+			return m, err
+		}
+	}
+	if n >= 0 {
+		r = io.LimitReader(r, n)
+	}
+	return copyPipelined(multiWriter(dsts), r, buf)
+}
+
+func multiWriter(outs []destFile) io.Writer {
+	writers := make([]io.Writer, len(outs))
+	for i := range outs {
+		writers[i] = outs[i]
+	}
+	return io.MultiWriter(writers...)
+}
+
+// copySparse copies only the data segments of src, leaving holes
+// unallocated in each destination. Filesystems without SEEK_DATA support
+// report the whole file as a single data segment. With zeros, runs of
+// all-zero blocks inside the data are left as holes too. If sum is not
+// nil, holes are written to it as zeros so it sees the same bytes as a
+// full read.
+func copySparse(dsts []destFile, src *os.File, r io.Reader, size int64, buf []byte, sum io.Writer, zeros bool) (res copyResult, err error) {
+	if zeros && len(buf) == 0 {
+		buf = make([]byte, defaultBufferSize)
+	}
+
+	var off int64
+	for off < size {
+		data, hole, err := nextData(src, off)
+		if errors.Is(err, syscall.ENXIO) {
+			break // only a trailing hole remains
+		} else if errors.Is(err, syscall.EINVAL) && off == 0 {
+			if !zeros {
+				_, err = copyData(dsts, r, -1, buf)
+				return res, err
+			}
+			data, hole = 0, size
+		} else if err != nil {
+			return res, err
+		}
+		if data > off {
+			res.holes++
+			res.holeBytes += data - off
+			if err := writeZeros(sum, data-off, buf); err != nil {
+				return res, err
+			}
+		}
+
+		if _, err := src.Seek(data, io.SeekStart); err != nil {
+			return res, err
+		}
+		for _, dst := range dsts {
+			if _, err := dst.Seek(data, io.SeekStart); err != nil {
+				return res, err
+			}
+		}
+		var n int64
+		if zeros {
+			n, err = copySkippingZeros(dsts, io.LimitReader(r, hole-data), buf, &res)
+		} else {
+			n, err = copyData(dsts, r, hole-data, buf)
+		}
+		if err != nil {
+			return res, err
+		} else if n < hole-data {
+			return res, io.ErrUnexpectedEOF
+		}
+		off = hole
+	}
+
+	if off < size {
+		res.holes++
+		res.holeBytes += size - off
+		if err := writeZeros(sum, size-off, buf); err != nil {
+			return res, err
+		}
+	}
+	for _, dst := range dsts {
+		if err := dst.Truncate(size); err != nil {
+			return res, err
+		}
+	}
+	return res, nil
+}
+
+// sparseBlock is the granularity of zero detection, the usual filesystem
+// block size. Smaller runs of zeros couldn't become holes anyway.
+const sparseBlock = 4096
+
+var zeroBlock [sparseBlock]byte
+
+// copySkippingZeros copies r to dsts like io.CopyBuffer, but seeks over
+// all-zero blocks instead of writing them. The caller truncates dsts to
+// the full size afterwards so that a trailing run of zeros is kept.
+func copySkippingZeros(dsts []destFile, r io.Reader, buf []byte, res *copyResult) (n int64, err error) {
+	w := multiWriter(dsts)
+	var skip int64 // zeros seeked over since the last write
+	for {
+		m, readErr := io.ReadFull(r, buf)
+		start := 0 // beginning of the pending run of data in buf
+		for off := 0; off < m; off += sparseBlock {
+			block := buf[off:min(off+sparseBlock, m)]
+			if !bytes.Equal(block, zeroBlock[:len(block)]) {
+				continue
+			}
+			if start < off {
+				if err := seekAll(dsts, skip); err != nil {
+					return n, err
+				}
+				skip = 0
+				if _, err := w.Write(buf[start:off]); err != nil {
+					return n, err
+				}
+			}
+			if skip == 0 {
+				res.holes++
+			}
+			skip += int64(len(block))
+			res.holeBytes += int64(len(block))
+			start = off + len(block)
+		}
+		if start < m {
+			if err := seekAll(dsts, skip); err != nil {
+				return n, err
+			}
+			skip = 0
+			if _, err := w.Write(buf[start:m]); err != nil {
+				return n, err
+			}
+		}
+		n += int64(m)
+
+		if readErr == io.EOF || readErr == io.ErrUnexpectedEOF {
+			return n, seekAll(dsts, skip)
+		} else if readErr != nil {
+			return n, readErr
+		}
+	}
+}
+
+func seekAll(dsts []destFile, n int64) error {
+	if n == 0 {
+		return nil
+	}
+	for _, dst := range dsts {
+		if _, err := dst.Seek(n, io.SeekCurrent); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeZeros(w io.Writer, n int64, buf []byte) error {
+	if w == nil {
+		return nil
+	}
+	if len(buf) == 0 {
+		buf = make([]byte, 32*1024)
+	}
+	clear(buf)
+	for n > 0 {
+		m := min(n, int64(len(buf)))
+		if _, err := w.Write(buf[:m]); err != nil {
+			return err
+		}
+		n -= m
+	}
+	return nil
+}
+
+// preserveMetadata applies the source mode (subject to --chmod and --umask),
+// ownership, and timestamps like cp -p, or whichever of them --preserve
+// lists. Ownership is best effort since only root may give files away.
+func (s *Session) preserveMetadata(dst string, sInfo os.FileInfo) error {
+	keep, caps := s.args.Preserve, s.capsOf(dst)
+	if keep.Ownership && caps.chown {
+		copyOwner(dst, sInfo)
+	}
+	if keep.Mode || s.args.Chmod.HasFile || s.args.Umask != 0 {
+		if err := os.Chmod(dst, s.fileMode(sInfo.Mode())); err != nil {
+			return err
+		}
+	}
+	if !keep.Timestamps || !caps.chtimes {
+		return nil
+	}
+	if err := os.Chtimes(dst, fileAtime(sInfo), sInfo.ModTime()); err != nil {
+		return fmt.Errorf("preserve times: %w", err)
+	}
+	return nil
+}
+
+// copyOwner gives dst the owner and group of the file info describes,
+// ignoring failures. Windows has no numeric owners, so nothing is done
+// there.
+func copyOwner(dst string, info os.FileInfo) {
+	if uid, gid, ok := fileOwner(info); ok {
+		_ = os.Lchown(dst, uid, gid)
+	}
+}
+
+// setMetadata sets the mode and timestamps of dst. A zero time leaves that
+// timestamp unchanged.
+func setMetadata(dst string, mode fs.FileMode, atime, mtime time.Time) error {
+	if err := os.Chmod(dst, mode); err != nil {
+		return err
+	}
+	if atime.IsZero() && mtime.IsZero() {
+		return nil
+	}
+	if err := os.Chtimes(dst, atime, mtime); err != nil {
+		return fmt.Errorf("preserve times: %w", err)
+	}
+	return nil
+}
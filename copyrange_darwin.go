@@ -0,0 +1,8 @@
+package main
+
+// copyRange isn't available on macOS: fcopyfile copies whole files from
+// the start, which doesn't fit sparse segments. Data is copied through a
+// buffer instead.
+func (r *interruptReader) copyRange(dst destFile, n int64) (int64, error) {
+	return 0, errNoCopyRange
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// copyRangeChunk bounds each copy_file_range call so an interrupt or the
+// progress line doesn't wait for a whole multi-gigabyte file.
+const copyRangeChunk = 8 << 20
+
+// copyRange copies n bytes, or up to EOF if n is negative, from the
+// source's current offset to dst's inside the kernel, so the data never
+// passes through userspace. It returns errNoCopyRange, having copied
+// nothing, where the kernel or filesystems don't support copy_file_range.
+func (r *interruptReader) copyRange(dst destFile, n int64) (int64, error) {
+	src, ok := r.r.(*os.File)
+	if !ok {
+		return 0, errNoCopyRange
+	}
+	var done int64
+	for n < 0 || done < n {
+		if r.stop.Load() {
+			return done, errInterrupted
+		} else if r.watch.abandoned() {
+			return done, errStalled
+		}
+		chunk := int64(copyRangeChunk)
+		if r.limit != nil {
+			chunk = r.limit.burst()
+		}
+		if n >= 0 {
+			chunk = min(chunk, n-done)
+		}
+		m, err := unix.CopyFileRange(int(src.Fd()), nil, int(dst.Fd()), nil, int(chunk), 0)
+		if err != nil {
+			// Before 5.3 copy_file_range only works within one filesystem
+			if done == 0 && (errors.Is(err, syscall.EXDEV) || errors.Is(err, syscall.ENOSYS) ||
+				errors.Is(err, syscall.EOPNOTSUPP) || errors.Is(err, syscall.EINVAL)) {
+				return 0, errNoCopyRange
+			}
+			return done, &destError{dst.dest, err}
+		}
+		if m == 0 {
+			break
+		}
+		done += int64(m)
+		r.n += int64(m)
+		r.count.Add(int64(m))
+		r.watch.touch()
+		r.nocache.copied(int64(m))
+		if !r.limit.wait(int64(m), r.stop) {
+			return done, errInterrupted
+		}
+	}
+	return done, nil
+}
@@ -0,0 +1,7 @@
+package main
+
+// copyRange isn't available on Windows. Data is copied through a buffer
+// instead.
+func (r *interruptReader) copyRange(dst destFile, n int64) (int64, error) {
+	return 0, errNoCopyRange
+}
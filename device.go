@@ -0,0 +1,132 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// existingParent returns path, or its nearest ancestor that exists when
+// path hasn't been created yet.
+func existingParent(path string) (string, os.FileInfo, error) {
+	for {
+		info, err := os.Stat(path)
+		if err == nil {
+			return path, info, nil
+		}
+		parent := filepath.Dir(path)
+		if !os.IsNotExist(err) || parent == path {
+			return "", nil, err
+		}
+		path = parent
+	}
+}
+
+// deviceOf returns the device ID of path or of its nearest existing parent.
+func deviceOf(path string) (uint64, error) {
+	path, info, err := existingParent(path)
+	if err != nil {
+		return 0, err
+	}
+	dev, ok := pathDevice(path, info)
+	if !ok {
+		return 0, fmt.Errorf("%s: device ID not available", path)
+	}
+	return dev, nil
+}
+
+func (s *Session) checkSameDevice() error {
+	src, err := deviceOf(s.args.Source)
+	if err != nil {
+		return err
+	}
+	dst, err := deviceOf(s.args.Destination)
+	if err != nil {
+		return err
+	}
+	if src != dst {
+		return fmt.Errorf("refusing to continue: %s and %s are on different devices (--require-same-device), so an in-place reorganization would turn into a full copy of every file", s.args.Source, s.args.Destination)
+	}
+	return nil
+}
+
+// realPath resolves symlinks in path, including in a destination that
+// doesn't exist yet by resolving its nearest existing parent.
+func realPath(path string) (string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	parent, _, err := existingParent(abs)
+	if err != nil {
+		return "", err
+	}
+	real, err := filepath.EvalSymlinks(parent)
+	if err != nil {
+		return "", err
+	}
+	rest, _ := filepath.Rel(parent, abs)
+	return filepath.Join(real, rest), nil
+}
+
+// within reports whether path is dir or somewhere below it.
+func within(path, dir string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// checkNesting refuses destinations inside the source, which the scan
+// would walk into and copy again, and destinations that contain the
+// source. With --force the run goes ahead, destinations inside the source
+// are left out of the scan, and a source inside a destination is left out
+// of --delete.
+func (s *Session) checkNesting() error {
+	src, err := realPath(s.args.Source)
+	if err != nil {
+		return err
+	}
+	for _, dest := range append([]string{s.args.Destination, s.args.MirrorTo}, s.args.Next...) {
+		if dest == "" {
+			continue
+		}
+		dst, err := realPath(dest)
+		if err != nil {
+			return err
+		}
+		var problem string
+		switch {
+		case within(dst, src):
+			problem = "is inside the source"
+			rel, _ := filepath.Rel(src, dst)
+			s.nestedDests = append(s.nestedDests, rel)
+		case within(src, dst):
+			problem = "contains the source"
+			rel, _ := filepath.Rel(dst, src)
+			s.nestedSources[dest] = rel
+		default:
+			continue
+		}
+		if !s.args.Force {
+			return fmt.Errorf("refusing to continue: destination %s %s %s (--force to copy anyway)", dest, problem, s.args.Source)
+		}
+		fmt.Fprintf(s.out, "Warning: destination %s %s %s\n", dest, problem, s.args.Source)
+	}
+	return nil
+}
+
+// sameFileAs returns the first of dsts that is src itself, reached through
+// a symlink, a bind mount, or a hard link. Opening it for writing would
+// truncate the source.
+func sameFileAs(src string, dsts []string) string {
+	sInfo, err := os.Stat(src)
+	if err != nil {
+		return ""
+	}
+	for _, dst := range dsts {
+		if dInfo, err := os.Stat(dst); err == nil && os.SameFile(sInfo, dInfo) {
+			return dst
+		}
+	}
+	return ""
+}
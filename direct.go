@@ -0,0 +1,52 @@
+package main
+
+import (
+	"io"
+	"os"
+	"unsafe"
+)
+
+// directAlign is the buffer, offset, and length alignment O_DIRECT needs
+// on the usual 4KiB-sector devices.
+const directAlign = 4096
+
+// directBuffer returns a buffer of at least the copy buffer size, and at
+// least 1MiB, starting on a directAlign boundary.
+func (s *Session) directBuffer() []byte {
+	size := (max(s.bufferSize, 1<<20) + directAlign - 1) / directAlign * directAlign
+	b := make([]byte, size+directAlign)
+	skip := (directAlign - int(uintptr(unsafe.Pointer(&b[0]))%directAlign)) % directAlign
+	return b[skip : skip+size]
+}
+
+// copyDirect copies r to outs with --direct, which bypasses the page cache
+// so a huge copy doesn't push everything else out of memory. Files and
+// filesystems that refuse O_DIRECT are copied through the cache as usual.
+// The final block of a file is rarely whole, so direct I/O is turned off
+// again to write it.
+func copyDirect(outs []destFile, in *os.File, r io.Reader, buf []byte) error {
+	setDirect(in, true)
+	defer setDirect(in, false)
+	for _, out := range outs {
+		setDirect(out.File, true)
+	}
+	w := multiWriter(outs)
+	for {
+		n, readErr := io.ReadFull(r, buf)
+		if n%directAlign != 0 {
+			for _, out := range outs {
+				setDirect(out.File, false)
+			}
+		}
+		if n > 0 {
+			if _, err := w.Write(buf[:n]); err != nil {
+				return err
+			}
+		}
+		if readErr == io.EOF || readErr == io.ErrUnexpectedEOF {
+			return nil
+		} else if readErr != nil {
+			return readErr
+		}
+	}
+}
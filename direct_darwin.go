@@ -0,0 +1,17 @@
+package main
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// setDirect turns caching off or on for an open file with F_NOCACHE,
+// macOS's counterpart to O_DIRECT. It has no alignment requirements.
+func setDirect(f *os.File, on bool) {
+	v := 0
+	if on {
+		v = 1
+	}
+	_, _ = unix.FcntlInt(f.Fd(), unix.F_NOCACHE, v)
+}
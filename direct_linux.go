@@ -0,0 +1,22 @@
+package main
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// setDirect turns O_DIRECT on or off for an open file. Filesystems that
+// don't support it, such as tmpfs, keep using the page cache.
+func setDirect(f *os.File, on bool) {
+	flags, err := unix.FcntlInt(f.Fd(), unix.F_GETFL, 0)
+	if err != nil {
+		return
+	}
+	if on {
+		flags |= unix.O_DIRECT
+	} else {
+		flags &^= unix.O_DIRECT
+	}
+	_, _ = unix.FcntlInt(f.Fd(), unix.F_SETFL, flags)
+}
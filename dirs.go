@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// createEmptyDirs recreates the scanned directories that hold no selected
+// files on dest. Directories with files are created as the files are
+// copied, on whichever disk each file lands.
+func (s *Session) createEmptyDirs(dest string) {
+	if s.args.NoEmptyDirs || dest == "" {
+		return
+	}
+
+	s.mu.Lock()
+	used := make(map[string]bool)
+	for _, rel := range s.allPaths {
+		for dir := filepath.Dir(rel); !used[dir] && dir != "."; dir = filepath.Dir(dir) {
+			used[dir] = true
+		}
+	}
+	var empty []string
+	for _, dir := range s.scanDirs {
+		if !used[dir] {
+			empty = append(empty, dir)
+		}
+	}
+	s.mu.Unlock()
+
+	for _, dir := range empty {
+		if err := s.mkdirAll(filepath.Join(dest, s.args.destName(dir))); err != nil {
+			s.mu.Lock()
+			fmt.Fprintf(s.out, "\r%v\033[K\n", err)
+			s.progress.Errors++
+			s.emit(Event{Type: EventError, Path: dir + "/", Detail: err.Error()})
+			s.mu.Unlock()
+		}
+	}
+	s.mu.Lock()
+	s.emptyDirs = append(s.emptyDirs, empty...)
+	s.mu.Unlock()
+}
+
+// setDirMetadata gives every directory on dest that holds a copied file
+// the timestamps of its source directory, which creating the files inside
+// it changed, and the source's mode and owner as --preserve says. It runs
+// once a destination is finished with, after its sidecar files are
+// written, so a read-only directory can't block them, and can safely run
+// again. The destination root keeps its own mode and owner.
+func (s *Session) setDirMetadata(dest string) {
+	if dest == "" {
+		return
+	}
+	s.copyDirMetadata(dest, s.destDirs(dest))
+}
+
+// copyDirMetadata applies the metadata of the source directories in dirs,
+// which maps destination directories to them, to those on dest.
+func (s *Session) copyDirMetadata(dest string, dirs map[string]string) {
+	keep, caps := s.args.Preserve, s.capsOf(dest)
+	for dir, src := range dirs {
+		info, err := os.Stat(filepath.Join(s.args.Source, src))
+		if err != nil {
+			continue
+		}
+		path := filepath.Join(dest, dir)
+		if dir != "." {
+			if keep.Ownership && caps.chown {
+				copyOwner(path, info)
+			}
+			if keep.Mode && !s.args.Chmod.HasDir {
+				_ = os.Chmod(path, info.Mode()&permBits&^fs.FileMode(s.args.Umask))
+			}
+			if s.args.MacMetadata {
+				_, _ = copyMacMetadata(filepath.Join(s.args.Source, src), path)
+			}
+		}
+		if keep.Timestamps && caps.chtimes {
+			_ = os.Chtimes(path, fileAtime(info), info.ModTime())
+		}
+	}
+}
+
+// destDirs maps every directory on dest that holds a copied file, or was
+// created empty, to its source directory.
+func (s *Session) destDirs(dest string) map[string]string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	dirs := make(map[string]string) // destination dir -> source dir
+	for _, p := range s.placed {
+		if p.dest != dest && p.mirror != dest {
+			continue
+		}
+		dir, src := filepath.Dir(p.dstRel), filepath.Dir(p.rel)
+		for {
+			if _, seen := dirs[dir]; seen {
+				break
+			}
+			dirs[dir] = src
+			if dir == "." {
+				break
+			}
+			dir, src = filepath.Dir(dir), filepath.Dir(src)
+		}
+	}
+	if dest == s.args.Destination || dest == s.args.MirrorTo {
+		for _, dir := range s.emptyDirs {
+			dirs[s.args.destName(dir)] = dir
+		}
+	}
+	return dirs
+}
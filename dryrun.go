@@ -0,0 +1,203 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+)
+
+// dryRun walks through the copy without writing anything, printing where
+// each file would go and when a full destination would be switched. Files
+// are skipped, and names resolved with --on-conflict, as the copy would.
+// Free space is taken from the destinations as they are now, with every
+// file rounded up to whole blocks.
+func (s *Session) dryRun() error {
+	s.mu.Lock()
+	s.guessCaps(s.args.Destination)
+	s.guessCaps(s.args.MirrorTo)
+	s.mu.Unlock()
+
+	dests := append([]string{s.args.Destination}, s.args.Next...)
+	var avail uint64
+	var block int64
+	disk := 0
+	next := func() error {
+		var err error
+		avail, block, err = s.usableSpace(dests[disk])
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(s.out, "Destination %s: %s free\n", dests[disk], humanBytes(int64(avail)))
+		return nil
+	}
+	if err := next(); err != nil {
+		return err
+	}
+	var mirrorAvail uint64
+	var mirrorBlock int64
+	if s.args.MirrorTo != "" {
+		var err error
+		if mirrorAvail, mirrorBlock, err = s.usableSpace(s.args.MirrorTo); err != nil {
+			return err
+		}
+		fmt.Fprintf(s.out, "Mirror %s: %s free\n", s.args.MirrorTo, humanBytes(int64(mirrorAvail)))
+	}
+
+	var copied, skipped Stats
+	var deferred []dryRunFile
+	onDisk := 0
+	// place finds room for a file, moving on to the next destination when
+	// it doesn't fit, and returns false once there are none left
+	place := func(f dryRunFile) (bool, error) {
+		if s.args.MirrorTo != "" {
+			mirrorNeed := uint64(allocated(f.size, mirrorBlock))
+			if mirrorNeed > mirrorAvail {
+				fmt.Fprintf(s.out, "Would fill mirror %s at %s and ask for another mirror destination\n", s.args.MirrorTo, f.rel)
+				return false, nil
+			}
+			mirrorAvail -= mirrorNeed
+		}
+		need := uint64(allocated(f.size, block))
+		if need > avail && s.args.Pack == "greedy" && onDisk > 0 {
+			fmt.Fprintf(s.out, "would hold back for the next destination: %s\n", f.rel)
+			deferred = append(deferred, f)
+			return true, nil
+		}
+		if need > avail && s.args.Chunk {
+			for left, part := f.size, 1; ; part++ {
+				room := max(int64(avail)-chunkMapRoom, 0) / max(block, 1) * max(block, 1)
+				if room >= min(minChunk, left) {
+					n := min(room, left)
+					fmt.Fprintf(s.out, "would copy: %s part %d -> %s (%s)\n", f.rel, part, dests[disk], humanBytes(n))
+					avail -= uint64(n)
+					left -= n
+					onDisk++
+					if left == 0 {
+						break
+					}
+				}
+				if disk == len(dests)-1 {
+					return false, nil
+				}
+				disk++
+				onDisk = 0
+				fmt.Fprintf(s.out, "Would switch to %s: %s continues there\n", dests[disk], f.rel)
+				if err := next(); err != nil {
+					return false, err
+				}
+			}
+			copied.Files++
+			copied.Bytes += f.size
+			return true, nil
+		}
+		for need > avail {
+			if disk == len(dests)-1 {
+				return false, nil
+			}
+			disk++
+			onDisk = 0
+			fmt.Fprintf(s.out, "Would switch to %s: %s doesn't fit\n", dests[disk], f.rel)
+			if err := next(); err != nil {
+				return false, err
+			}
+		}
+		avail -= need
+		onDisk++
+
+		fmt.Fprintf(s.out, "would copy: %s -> %s (%s)\n", f.rel, dests[disk], humanBytes(f.size))
+		copied.Files++
+		copied.Bytes += f.size
+		return true, nil
+	}
+
+	for i := s.args.StartIndex; ; i++ {
+		rel, more, err := s.waitPath(i, nil)
+		if err != nil {
+			return err
+		} else if !more {
+			break
+		}
+		if len(s.sigIntChan) > 0 {
+			return &exitError{130, errInterrupted}
+		}
+
+		src := filepath.Join(s.args.Source, rel)
+		info, err := s.args.statSource(src)
+		if err != nil {
+			fmt.Fprintf(s.out, "%v\n", err)
+			continue
+		}
+		reason := s.skipReason(rel, src, info)
+		if reason == "" {
+			name, clash := s.claimDestName(rel, info)
+			name, action := s.resolveConflict(rel, name, clash, info, []string{dests[disk], s.args.MirrorTo})
+			switch action {
+			case conflictSkip:
+				reason = "exists"
+			case conflictError:
+				fmt.Fprintf(s.out, "would fail: %s: destination already exists\n", name)
+				continue
+			case conflictRename:
+				fmt.Fprintf(s.out, "would rename: %s -> %s\n", rel, name)
+			case conflictPrompt:
+				fmt.Fprintf(s.out, "would ask: %s already exists at the destination\n", name)
+			}
+		}
+		if reason != "" {
+			fmt.Fprintf(s.out, "would skip %s: %s\n", reason, rel)
+			skipped.Files++
+			skipped.Bytes += info.Size()
+			continue
+		}
+
+		if ok, err := place(dryRunFile{rel, info.Size()}); err != nil {
+			return err
+		} else if !ok {
+			<-s.scanDone
+			remaining := len(s.allPaths) - i + len(deferred)
+			fmt.Fprintf(s.out, "Would fill %s at %s and ask for another destination; %d files not placed yet\n", dests[disk], rel, remaining)
+			return s.printDryRunTotals(copied, skipped)
+		}
+	}
+
+	for len(deferred) > 0 {
+		if disk == len(dests)-1 {
+			fmt.Fprintf(s.out, "Would fill %s and ask for another destination; %d files not placed yet\n", dests[disk], len(deferred))
+			return s.printDryRunTotals(copied, skipped)
+		}
+		disk++
+		onDisk = 0
+		fmt.Fprintf(s.out, "Would switch to %s for %d held back files\n", dests[disk], len(deferred))
+		if err := next(); err != nil {
+			return err
+		}
+		files := deferred
+		deferred = nil
+		for j, f := range files {
+			if ok, err := place(f); err != nil {
+				return err
+			} else if !ok {
+				fmt.Fprintf(s.out, "Would fill %s at %s and ask for another destination; %d files not placed yet\n", dests[disk], f.rel, len(files)-j+len(deferred))
+				return s.printDryRunTotals(copied, skipped)
+			}
+		}
+	}
+
+	if err := s.checkSelected(s.args.StartIndex); err != nil {
+		return err
+	}
+	return s.printDryRunTotals(copied, skipped)
+}
+
+func (s *Session) printDryRunTotals(copied, skipped Stats) error {
+	fmt.Fprintf(s.out, "Dry run: would copy %d files (%s)", copied.Files, humanBytes(copied.Bytes))
+	if skipped.Files > 0 {
+		fmt.Fprintf(s.out, ", skip %d (%s)", skipped.Files, humanBytes(skipped.Bytes))
+	}
+	fmt.Fprintln(s.out)
+	return nil
+}
+
+type dryRunFile struct {
+	rel  string
+	size int64
+}
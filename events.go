@@ -0,0 +1,135 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/term"
+)
+
+// Event is a single machine-readable occurrence during a run.
+type Event struct {
+	Type   string
+	Path   string
+	Bytes  int64
+	Detail string
+
+	Duration time.Duration // how long a copied file took
+}
+
+const (
+	EventCopied    = "copied"    // Path was copied; Bytes is its size and Detail the destination
+	EventSkipped   = "skipped"   // Path was not copied; Bytes is its size and Detail the reason
+	EventError     = "error"     // Path failed; Detail is the error
+	EventDest      = "dest"      // Detail is the new destination after a disk swap
+	EventMirror    = "mirror"    // Detail is the new mirror destination after a disk swap
+	EventMismatch  = "mismatch"  // Path failed verification; Detail is the reason
+	EventRemaining = "remaining" // Bytes paths still need copying; Detail is the list file
+	EventDone      = "done"      // Bytes in total were copied; Detail is the file count
+
+	// Only reported by --json-events; --porcelain v1 predates these.
+	EventStarted = "started" // copying Path began; Bytes is its size
+	EventFull    = "full"    // a destination failed, usually because it is full; Detail is the error
+	EventScanned = "scanned" // the scan finished; Bytes is the total size and Detail the file count
+	EventDeleted = "deleted" // --delete removed Path (ending in / for a directory) from destination Detail
+	EventRenamed = "renamed" // Path is written under the name Detail to avoid overwriting another file
+	EventRetry   = "retry"   // copying Path failed with a transient error and is tried again; Detail is the error
+)
+
+type eventSink interface {
+	emit(Event)
+}
+
+// porcelainSink writes the frozen --porcelain format: one line per event
+// with tab-separated fields TYPE, PATH, BYTES, DETAIL. Backslash, tab, and
+// newline inside fields are escaped as \\, \t, and \n.
+type porcelainSink struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+const porcelainVersion = 1
+
+func newPorcelainSink(w io.Writer) *porcelainSink {
+	fmt.Fprintf(w, "# splitcopy porcelain v%d\n", porcelainVersion)
+	return &porcelainSink{w: w}
+}
+
+var porcelainEscaper = strings.NewReplacer(`\`, `\\`, "\t", `\t`, "\n", `\n`)
+
+func (p *porcelainSink) emit(e Event) {
+	switch e.Type {
+	case EventStarted, EventFull, EventScanned, EventDeleted, EventRenamed, EventRetry:
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	fmt.Fprintf(p.w, "%s\t%s\t%d\t%s\n", e.Type, porcelainEscaper.Replace(e.Path), e.Bytes, porcelainEscaper.Replace(e.Detail))
+}
+
+// jsonSink writes --json-events: one JSON object per line.
+type jsonSink struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+type jsonEvent struct {
+	Time    time.Time `json:"time"`
+	Type    string    `json:"type"`
+	Path    string    `json:"path,omitempty"`
+	Bytes   int64     `json:"bytes"`
+	Detail  string    `json:"detail,omitempty"`
+	Seconds float64   `json:"seconds,omitempty"`
+}
+
+func newJSONSink(w io.Writer) *jsonSink {
+	return &jsonSink{enc: json.NewEncoder(w)}
+}
+
+func (j *jsonSink) emit(e Event) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.enc.Encode(jsonEvent{
+		Time:    time.Now(),
+		Type:    e.Type,
+		Path:    e.Path,
+		Bytes:   e.Bytes,
+		Detail:  e.Detail,
+		Seconds: e.Duration.Seconds(),
+	})
+}
+
+// openEventSinks opens the --json-events file or --events-fd descriptor.
+// Writing events to stdout moves human output to stderr.
+func (s *Session) openEventSinks() error {
+	switch {
+	case s.args.JSONEvents == "-":
+		s.out = os.Stderr
+		s.isTTY = term.IsTerminal(int(os.Stderr.Fd()))
+		s.sinks = append(s.sinks, newJSONSink(os.Stdout))
+	case s.args.JSONEvents != "":
+		f, err := os.Create(s.args.JSONEvents)
+		if err != nil {
+			return err
+		}
+		s.sinks = append(s.sinks, newJSONSink(f))
+	case s.args.EventsFD > 0:
+		f := os.NewFile(uintptr(s.args.EventsFD), "events")
+		if _, err := f.Stat(); err != nil {
+			return fmt.Errorf("--events-fd %d: %w", s.args.EventsFD, err)
+		}
+		s.sinks = append(s.sinks, newJSONSink(f))
+	}
+	return nil
+}
+
+func (s *Session) emit(e Event) {
+	for _, sink := range s.sinks {
+		sink.emit(e)
+	}
+}
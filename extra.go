@@ -0,0 +1,148 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+)
+
+// walkExtra walks dest and calls fn for every file that the source scan,
+// with the same filters, didn't find. Files the filters exclude are left
+// alone, as are splitcopy's own checksum and par2 files, and the source
+// itself when it is inside dest (--force). It also returns
+// the directories under dest that don't exist in the source.
+func (s *Session) walkExtra(dest string, fn func(rel string) error) ([]string, error) {
+	s.mu.Lock()
+	scanned := make(map[string]bool, len(s.allPaths))
+	for _, rel := range s.allPaths {
+		scanned[s.args.destName(filepath.Clean(rel))+s.args.PipeSuffix] = true
+	}
+	for _, p := range s.placed {
+		if p.dstRel != "" {
+			scanned[s.args.destName(p.dstRel)] = true // renamed by --on-conflict
+		}
+	}
+	srcDirs := make(map[string]bool, len(s.scanDirs))
+	for _, dir := range s.scanDirs {
+		srcDirs[s.args.destName(dir)] = true
+	}
+	source, nested := s.nestedSources[dest]
+	s.mu.Unlock()
+
+	var dirs []string
+	err := filepath.WalkDir(dest, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if path == dest {
+			return nil
+		}
+		rel, _ := filepath.Rel(dest, path)
+		if nested && rel == source {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if s.args.ExcludeHidden && isHidden(d.Name()) || s.args.excluded(rel, d.IsDir()) || s.ignored(rel, d.IsDir()) || s.args.Trash && isTrashDir(rel) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() {
+			if _, err := os.Lstat(filepath.Join(s.args.Source, rel)); os.IsNotExist(err) && !srcDirs[s.args.destName(rel)] {
+				dirs = append(dirs, rel)
+			}
+			return nil
+		}
+		if scanned[s.args.destName(rel)] || isSidecar(rel) {
+			return nil
+		}
+		if s.args.hasAttrFilters() {
+			if info, err := d.Info(); err == nil && !s.args.selected(info) {
+				return nil
+			}
+		}
+		return fn(rel)
+	})
+	return dirs, err
+}
+
+// deleteExtra removes files from dest that aren't in the source, and then
+// the directories that are left empty and don't exist in the source either.
+func (s *Session) deleteExtra(dest string) error {
+	var deleted int
+	changed := make(map[string]bool) // directories something was deleted from
+	dirs, err := s.walkExtra(dest, func(rel string) error {
+		if err := os.Remove(filepath.Join(dest, rel)); err != nil {
+			return err
+		}
+		deleted++
+		changed[filepath.Dir(rel)] = true
+		s.mu.Lock()
+		s.emit(Event{Type: EventDeleted, Path: rel, Detail: dest})
+		s.mu.Unlock()
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("--delete: %w", err)
+	}
+
+	// Deepest first, so parents are empty by the time they come up
+	slices.Reverse(dirs)
+	for _, rel := range dirs {
+		if os.Remove(filepath.Join(dest, rel)) == nil {
+			changed[filepath.Dir(rel)] = true
+			s.mu.Lock()
+			s.emit(Event{Type: EventDeleted, Path: rel + "/", Detail: dest})
+			s.mu.Unlock()
+		}
+	}
+	fmt.Fprintf(s.out, "Deleted %d files from %s that are not in the source\n", deleted, dest)
+
+	// Deleting changed their times, even where no file was copied to them
+	srcDirs := map[string]string{".": "."}
+	s.mu.Lock()
+	for _, dir := range s.scanDirs {
+		srcDirs[s.args.destName(dir)] = dir
+	}
+	s.mu.Unlock()
+	restore := make(map[string]string)
+	for dir := range changed {
+		if src, ok := srcDirs[dir]; ok {
+			restore[dir] = src
+		}
+	}
+	s.copyDirMetadata(dest, restore)
+	return nil
+}
+
+// deleteExtraAll runs --delete on each destination once the copy has
+// finished cleanly. Like rsync, nothing is deleted after errors, and
+// nothing at all once the run has spread over more than one disk, since
+// the source is then split and no one disk should hold all of it.
+func (s *Session) deleteExtraAll() error {
+	if !s.args.Delete {
+		return nil
+	}
+	if s.progress.Errors > 0 || s.scanErr != nil {
+		fmt.Fprintln(s.out, "Not deleting anything from the destination because of errors during the copy")
+		return nil
+	}
+	if s.progress.diskNum > 2 || s.progress.mirrorDiskNum > 2 {
+		fmt.Fprintln(s.out, "Not deleting anything from the destination because the copy spans more than one disk")
+		return nil
+	}
+	for _, dest := range []string{s.args.Destination, s.args.MirrorTo} {
+		if dest == "" {
+			continue
+		}
+		if err := s.deleteExtra(dest); err != nil {
+			return err
+		}
+	}
+	return nil
+}
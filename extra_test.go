@@ -0,0 +1,36 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDeleteSkipsNestedSource(t *testing.T) {
+	dst := t.TempDir()
+	src := filepath.Join(dst, "src")
+	for _, name := range []string{"a", "sub/b"} {
+		path := filepath.Join(src, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(name), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(dst, "extra"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := run(t, "copy", src, dst, "--force", "--delete"); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"src/a", "src/sub/b", "a", "sub/b"} {
+		if _, err := os.Stat(filepath.Join(dst, name)); err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dst, "extra")); !os.IsNotExist(err) {
+		t.Errorf("extra: got %v, want it deleted", err)
+	}
+}
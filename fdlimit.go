@@ -0,0 +1,44 @@
+package main
+
+import "sync"
+
+// fdSemaphore caps the number of file descriptors held open across all
+// workers, independent of how many files are copied concurrently.
+type fdSemaphore struct {
+	mu    sync.Mutex
+	cond  *sync.Cond
+	avail int
+	limit int
+}
+
+func newFDSemaphore(limit int) *fdSemaphore {
+	if limit <= 0 {
+		limit = defaultMaxOpenFiles()
+	}
+	sem := &fdSemaphore{avail: limit, limit: limit}
+	sem.cond = sync.NewCond(&sem.mu)
+	return sem
+}
+
+// fallbackMaxOpenFiles is used when the system sets no usable limit.
+const fallbackMaxOpenFiles = 512
+
+// acquire blocks until n descriptors are available. All n are taken at
+// once so that two workers can never deadlock holding partial sets.
+func (s *fdSemaphore) acquire(n int) int {
+	n = min(n, s.limit)
+	s.mu.Lock()
+	for s.avail < n {
+		s.cond.Wait()
+	}
+	s.avail -= n
+	s.mu.Unlock()
+	return n
+}
+
+func (s *fdSemaphore) release(n int) {
+	s.mu.Lock()
+	s.avail += n
+	s.mu.Unlock()
+	s.cond.Broadcast()
+}
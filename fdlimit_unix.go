@@ -0,0 +1,15 @@
+//go:build unix
+
+package main
+
+import "golang.org/x/sys/unix"
+
+// defaultMaxOpenFiles leaves half of the soft limit for the runtime,
+// readline, and anything else the process opens.
+func defaultMaxOpenFiles() int {
+	var rl unix.Rlimit
+	if err := unix.Getrlimit(unix.RLIMIT_NOFILE, &rl); err != nil || rl.Cur == unix.RLIM_INFINITY {
+		return fallbackMaxOpenFiles
+	}
+	return max(int(rl.Cur/2), 4)
+}
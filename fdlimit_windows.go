@@ -0,0 +1,7 @@
+package main
+
+// defaultMaxOpenFiles: Windows has no per-process limit on file handles
+// worth keeping under.
+func defaultMaxOpenFiles() int {
+	return fallbackMaxOpenFiles
+}
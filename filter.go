@@ -0,0 +1,249 @@
+package main
+
+import (
+	"io/fs"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/alecthomas/kong"
+)
+
+// Glob is an rsync-style pattern. A trailing slash matches only
+// directories. A pattern with a leading slash is anchored at the source
+// root, one with a slash elsewhere matches the end of the relative path,
+// and any other pattern matches the name at any depth. "*" doesn't cross
+// slashes; "**" does.
+type Glob struct {
+	pattern string
+	re      *regexp.Regexp
+	dirOnly bool
+	full    bool // match the whole relative path rather than the name
+}
+
+func (g *Glob) Decode(ctx *kong.DecodeContext) error {
+	var value string
+	if err := ctx.Scan.PopValueInto("pattern", &value); err != nil {
+		return err
+	}
+	parsed, err := parseGlob(value, false)
+	if err != nil {
+		return err
+	}
+	*g = parsed
+	return nil
+}
+
+// Regex is a flag value holding an RE2 regular expression.
+type Regex struct {
+	*regexp.Regexp
+}
+
+func (r *Regex) Decode(ctx *kong.DecodeContext) error {
+	var value string
+	if err := ctx.Scan.PopValueInto("regex", &value); err != nil {
+		return err
+	}
+	re, err := regexp.Compile(value)
+	if err != nil {
+		return err
+	}
+	r.Regexp = re
+	return nil
+}
+
+// parseGlob compiles a pattern. With anchorSlash, a slash anywhere but the
+// end anchors the pattern like in .gitignore files.
+func parseGlob(pattern string, anchorSlash bool) (Glob, error) {
+	g := Glob{pattern: pattern}
+	p := pattern
+	if strings.HasSuffix(p, "/") {
+		g.dirOnly = true
+		p = strings.TrimRight(p, "/")
+	}
+
+	prefix := "^"
+	if strings.HasPrefix(p, "/") {
+		g.full = true
+		p = strings.TrimLeft(p, "/")
+	} else if strings.Contains(p, "/") {
+		g.full = true
+		if !anchorSlash {
+			prefix = "(^|/)"
+		}
+	}
+
+	re, err := regexp.Compile(prefix + globToRegexp(p) + "$")
+	if err != nil {
+		return g, err
+	}
+	g.re = re
+	return g, nil
+}
+
+func globToRegexp(p string) string {
+	var b strings.Builder
+	for i := 0; i < len(p); i++ {
+		switch c := p[i]; c {
+		case '*':
+			if strings.HasPrefix(p[i:], "**/") {
+				b.WriteString("(.*/)?")
+				i += 2
+			} else if strings.HasPrefix(p[i:], "**") {
+				b.WriteString(".*")
+				i++
+			} else {
+				b.WriteString("[^/]*")
+			}
+		case '?':
+			b.WriteString("[^/]")
+		case '[':
+			end := strings.IndexByte(p[i+1:], ']')
+			if end < 0 {
+				b.WriteString(`\[`)
+				continue
+			}
+			class := p[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			b.WriteString("[" + strings.ReplaceAll(class, `\`, `\\`) + "]")
+			i += end + 1
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	return b.String()
+}
+
+func (g Glob) match(rel string, isDir bool) bool {
+	if g.dirOnly && !isDir {
+		return false
+	}
+	if g.full {
+		return g.re.MatchString(rel)
+	}
+	return g.re.MatchString(path.Base(rel))
+}
+
+// excluded reports whether a scanned entry is filtered out. --include
+// patterns override --exclude ones, and an excluded directory hides
+// everything below it. Regular expressions only apply to files.
+func (f *ScanFlags) excluded(rel string, isDir bool) bool {
+	rel = strings.TrimPrefix(filepath.ToSlash(rel), "./")
+	if !isDir && !f.matches(rel) {
+		return true
+	}
+	for _, g := range f.Include {
+		if g.match(rel, isDir) {
+			return false
+		}
+	}
+	for _, g := range f.Exclude {
+		if g.match(rel, isDir) {
+			return true
+		}
+	}
+	return false
+}
+
+func (f *ScanFlags) matches(rel string) bool {
+	for _, re := range f.NoMatch {
+		if re.MatchString(rel) {
+			return false
+		}
+	}
+	if len(f.Match) == 0 {
+		return true
+	}
+	for _, re := range f.Match {
+		if re.MatchString(rel) {
+			return true
+		}
+	}
+	return false
+}
+
+// excludedPath applies the filters to a path from a resume list, which
+// wasn't reached through its parent directories.
+func (f *ScanFlags) excludedPath(rel string) bool {
+	parts := strings.Split(filepath.ToSlash(rel), "/")
+	for i := 1; i < len(parts); i++ {
+		if f.excluded(strings.Join(parts[:i], "/"), true) {
+			return true
+		}
+	}
+	return f.excluded(rel, false)
+}
+
+// filterKey identifies the filters in effect, so that a scan cache made
+// with different ones isn't reused.
+func (f *ScanFlags) filterKey() []string {
+	var key []string
+	for _, g := range f.Include {
+		key = append(key, "+"+g.pattern)
+	}
+	for _, g := range f.Exclude {
+		key = append(key, "-"+g.pattern)
+	}
+	for _, re := range f.Match {
+		key = append(key, "~"+re.String())
+	}
+	for _, re := range f.NoMatch {
+		key = append(key, "!~"+re.String())
+	}
+	if f.OneFileSystem {
+		key = append(key, "x")
+	}
+	if f.Links != linksCopy {
+		key = append(key, "links="+f.Links)
+	}
+	return key
+}
+
+func (f *ScanFlags) hasAttrFilters() bool {
+	return f.MinSize > 0 || f.MaxSize > 0 || !f.NewerThan.IsZero() || !f.OlderThan.IsZero()
+}
+
+// selected applies the filters that need the file's metadata.
+func (f *ScanFlags) selected(info fs.FileInfo) bool {
+	size := info.Size()
+	if f.MinSize > 0 && size < int64(f.MinSize) {
+		return false
+	}
+	if f.MaxSize > 0 && size > int64(f.MaxSize) {
+		return false
+	}
+	if !f.NewerThan.IsZero() && !info.ModTime().After(f.NewerThan.Time) {
+		return false
+	}
+	if !f.OlderThan.IsZero() && !info.ModTime().Before(f.OlderThan.Time) {
+		return false
+	}
+	return true
+}
+
+// addSelected stats a scanned path for the running totals and adds it
+// unless an attribute filter rejects it.
+// Paths that can't be stat'ed are kept so the copy reports the error.
+func (s *Session) addSelected(rel string, d fs.DirEntry) {
+	var info fs.FileInfo
+	var err error
+	if d != nil {
+		info, err = d.Info()
+	} else {
+		info, err = s.args.statSource(filepath.Join(s.args.Source, rel))
+	}
+	if err != nil {
+		info = nil
+	} else if info.Mode()&fs.ModeSymlink != 0 && s.args.Links == linksSkip {
+		return
+	} else if info.Mode()&specialMode != 0 && !s.args.Specials {
+		s.skipSpecial(rel, info)
+		return
+	} else if s.args.hasAttrFilters() && !s.args.selected(info) {
+		return
+	}
+	s.addPath(rel, info)
+}
@@ -0,0 +1,45 @@
+package main
+
+import "testing"
+
+func TestGlob(t *testing.T) {
+	tests := []struct {
+		pattern string
+		rel     string
+		isDir   bool
+		want    bool
+	}{
+		{"*.txt", "a.txt", false, true},
+		{"*.txt", "dir/sub/a.txt", false, true},
+		{"*.txt", "a.txt.bak", false, false},
+		{"*.txt", "dir.txt/a", false, false},
+		{"a?c", "abc", false, true},
+		{"a?c", "a/c", false, false},
+		{"[ab].log", "b.log", false, true},
+		{"[!ab].log", "b.log", false, false},
+		{"[!ab].log", "c.log", false, true},
+		{"cache/", "x/cache", true, true},
+		{"cache/", "x/cache", false, false},
+		{"/build", "build", true, true},
+		{"/build", "src/build", true, false},
+		{"src/*.go", "src/main.go", false, true},
+		{"src/*.go", "repo/src/main.go", false, true},
+		{"src/*.go", "src/cmd/main.go", false, false},
+		{"src/**/*.go", "src/main.go", false, true},
+		{"src/**/*.go", "src/cmd/x/main.go", false, true},
+		{"/a/**", "a/b/c", false, true},
+		{"/a/**", "b/a/c", false, false},
+		{"a+b(1).txt", "a+b(1).txt", false, true},
+		{"[unclosed", "[unclosed", false, true},
+	}
+	for _, tt := range tests {
+		g, err := parseFlag[Glob](t, tt.pattern)
+		if err != nil {
+			t.Errorf("--exclude %s: %v", tt.pattern, err)
+			continue
+		}
+		if got := g.match(tt.rel, tt.isDir); got != tt.want {
+			t.Errorf("%q matching %q (dir %v) = %v, want %v", tt.pattern, tt.rel, tt.isDir, got, tt.want)
+		}
+	}
+}
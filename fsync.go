@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+)
+
+// --fsync policies, from safest to fastest
+const (
+	fsyncFile  = "per-file" // each file and its directory entry before it counts as done
+	fsyncDir   = "per-dir"  // each file, and its directories once the destination is finished
+	fsyncEnd   = "end"      // the whole filesystem once the destination is finished
+	fsyncNever = "never"
+)
+
+// syncFile flushes a finished copy to the device before it is renamed into
+// place, unless --fsync leaves that to the end.
+func (s *Session) syncFile(f destFile) error {
+	if s.args.Fsync != fsyncFile && s.args.Fsync != fsyncDir {
+		return nil
+	}
+	if err := f.Sync(); err != nil {
+		return &destError{f.dest, err}
+	}
+	return nil
+}
+
+// syncDest makes everything written to dest durable when it is finished
+// with, as --fsync per-dir or end says.
+func (s *Session) syncDest(dest string) {
+	if dest == "" {
+		return
+	}
+	var err error
+	switch s.args.Fsync {
+	case fsyncDir:
+		for dir := range s.destDirs(dest) {
+			if err = syncDir(filepath.Join(dest, dir)); err != nil {
+				break
+			}
+		}
+	case fsyncEnd:
+		err = syncFilesystem(dest)
+	}
+	if err != nil {
+		s.mu.Lock()
+		fmt.Fprintf(s.out, "\rfailed to sync %s: %v\033[K\n", dest, err)
+		s.progress.Errors++
+		s.emit(Event{Type: EventError, Path: dest, Detail: err.Error()})
+		s.mu.Unlock()
+	}
+}
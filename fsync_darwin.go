@@ -0,0 +1,9 @@
+package main
+
+import "golang.org/x/sys/unix"
+
+// syncFilesystem flushes pending writes; macOS has no syncfs, so this
+// syncs every filesystem.
+func syncFilesystem(path string) error {
+	return unix.Sync()
+}
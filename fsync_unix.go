@@ -0,0 +1,14 @@
+//go:build unix
+
+package main
+
+import "os"
+
+func syncDir(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return f.Sync()
+}
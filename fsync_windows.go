@@ -0,0 +1,41 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/sys/windows"
+)
+
+// syncDir does nothing on Windows: directories can't be flushed, and NTFS
+// journals their entries anyway.
+func syncDir(path string) error {
+	return nil
+}
+
+// syncFilesystem flushes every pending write on the volume holding path.
+// Opening a volume needs administrator rights.
+func syncFilesystem(path string) error {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	root := filepath.VolumeName(abs)
+	if strings.HasPrefix(root, `\\`) {
+		return fmt.Errorf("can't flush network share %s", root)
+	}
+	p, err := windows.UTF16PtrFromString(`\\.\` + root)
+	if err != nil {
+		return err
+	}
+	h, err := windows.CreateFile(p, windows.GENERIC_WRITE, windows.FILE_SHARE_READ|windows.FILE_SHARE_WRITE, nil, windows.OPEN_EXISTING, 0, 0)
+	if errors.Is(err, windows.ERROR_ACCESS_DENIED) {
+		return fmt.Errorf("flushing %s needs administrator rights: %w", root, err)
+	} else if err != nil {
+		return err
+	}
+	defer windows.CloseHandle(h)
+	return windows.FlushFileBuffers(h)
+}
@@ -5,10 +5,11 @@ go 1.25.1
 require (
 	github.com/alecthomas/kong v1.13.0
 	github.com/ergochat/readline v0.1.3
+	github.com/zeebo/blake3 v0.2.4
+	github.com/zeebo/xxh3 v1.1.0
+	golang.org/x/sys v0.39.0
 	golang.org/x/term v0.38.0
+	golang.org/x/text v0.9.0
 )
 
-require (
-	golang.org/x/sys v0.39.0 // indirect
-	golang.org/x/text v0.9.0 // indirect
-)
+require github.com/klauspost/cpuid/v2 v2.2.10 // indirect
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+)
+
+type inode struct{ dev, ino uint64 }
+
+// noteInode records the inode of a scanned file with more than one link.
+// Links are matched by what the scan saw rather than a later stat, since
+// --remove-source-files drops the link count as each link is moved. A
+// file whose other links were already moved is recognized by its inode.
+func (s *Session) noteInode(rel string, info os.FileInfo) {
+	if !s.args.keepHardLinks() || info == nil || !info.Mode().IsRegular() {
+		return
+	}
+	id, nlink, ok := fileInode(info)
+	if !ok {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, moved := s.links[id]; nlink > 1 || moved {
+		s.inodes[rel] = id
+	}
+}
+
+// rememberLink records where the first copy of a hard-linked source file
+// went so later links to it can point there. The caller must hold s.mu.
+func (s *Session) rememberLink(rel string, p placement) {
+	if key, ok := s.inodes[rel]; ok {
+		if _, seen := s.links[key]; !seen {
+			s.links[key] = p
+		}
+	}
+}
+
+// claimLink makes the caller the one to copy the content of rel's inode.
+// If another worker is already copying it, claimLink waits for that copy
+// so rel can be linked to it rather than copied a second time.
+func (s *Session) claimLink(rel string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key, ok := s.inodes[rel]
+	if !ok {
+		return
+	}
+	for s.linking[key] != "" && !s.interrupted.Load() {
+		s.pauseCond.Wait()
+	}
+	if _, seen := s.links[key]; !seen {
+		s.linking[key] = rel
+	}
+}
+
+// unclaimLink lets the workers waiting in claimLink for rel's inode go on.
+func (s *Session) unclaimLink(rel string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if key, ok := s.inodes[rel]; ok && s.linking[key] == rel {
+		delete(s.linking, key)
+		s.pauseCond.Broadcast()
+	}
+}
+
+// hardLink recreates a hard link at dsts if another link to the same
+// source inode was already copied to the same destination (and mirror).
+// It falls back to a normal copy when the files ended up on different
+// disks or the destination can't hold hard links.
+func (s *Session) hardLink(rel, dest, mirror string, dsts []string) (placement, bool) {
+	s.mu.Lock()
+	key, ok := s.inodes[rel]
+	first, seen := s.links[key]
+	s.mu.Unlock()
+	if !ok || !seen || first.dest != dest || first.mirror != mirror {
+		return placement{}, false
+	}
+
+	roots := []string{dest, mirror}
+	for i, dst := range dsts {
+		err := s.mkdirAll(filepath.Dir(dst))
+		if err == nil {
+			_ = os.Remove(dst)
+			err = os.Link(filepath.Join(roots[i], first.dstRel), dst)
+		}
+		if err != nil {
+			for _, made := range dsts[:i] {
+				_ = os.Remove(made)
+			}
+			return placement{}, false
+		}
+	}
+	return first, true
+}
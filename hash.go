@@ -0,0 +1,110 @@
+package main
+
+import (
+	"crypto/sha256"
+	"hash"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/zeebo/blake3"
+	"github.com/zeebo/xxh3"
+)
+
+// hashAlg is a digest selectable with --hash. xxh3 only guards against
+// accidental corruption such as bit rot; sha256 and blake3 also resist
+// deliberate tampering.
+type hashAlg struct {
+	name     string
+	sumsFile string // per-destination checksum list, named like the matching *sum tool expects
+	new      func() hash.Hash
+}
+
+var hashAlgs = map[string]hashAlg{
+	"sha256": {"sha256", "SHA256SUMS", sha256.New},
+	"xxh3":   {"xxh3", "XXH3SUMS", func() hash.Hash { return xxh3.New() }},
+	"blake3": {"blake3", "B3SUMS", func() hash.Hash { return blake3.New() }},
+}
+
+func lookupHash(name string) hashAlg {
+	if alg, ok := hashAlgs[name]; ok {
+		return alg
+	}
+	return hashAlgs["sha256"]
+}
+
+func (a hashAlg) file(path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	h := a.new()
+	if _, err := io.Copy(h, f); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
+
+// asyncHashDepth is how many writes an asyncHash holds before a writer
+// has to wait for the hash to catch up.
+const asyncHashDepth = 4
+
+// asyncHash feeds a hash from its own goroutine, so hashing the source for
+// --verify and --sums runs alongside the copy instead of inside its read
+// loop. Each write is copied first, since the caller reuses its buffer.
+type asyncHash struct {
+	hash.Hash
+	queue   chan []byte
+	free    chan []byte
+	pending sync.WaitGroup
+	stop    sync.Once
+}
+
+func newAsyncHash(h hash.Hash) *asyncHash {
+	a := &asyncHash{Hash: h, queue: make(chan []byte, asyncHashDepth), free: make(chan []byte, asyncHashDepth)}
+	go func() {
+		for b := range a.queue {
+			a.Hash.Write(b)
+			a.pending.Done()
+			select {
+			case a.free <- b:
+			default:
+			}
+		}
+	}()
+	return a
+}
+
+func (a *asyncHash) Write(p []byte) (int, error) {
+	var b []byte
+	select {
+	case b = <-a.free:
+	default:
+	}
+	if cap(b) < len(p) {
+		b = make([]byte, len(p))
+	}
+	b = b[:len(p)]
+	copy(b, p)
+	a.pending.Add(1)
+	a.queue <- b
+	return len(p), nil
+}
+
+// Sum waits for everything written so far to be hashed.
+func (a *asyncHash) Sum(b []byte) []byte {
+	a.pending.Wait()
+	return a.Hash.Sum(b)
+}
+
+func (a *asyncHash) Reset() {
+	a.pending.Wait()
+	a.Hash.Reset()
+}
+
+// close stops the hashing goroutine; the hash can't be written to after.
+func (a *asyncHash) close() {
+	a.stop.Do(func() { close(a.queue) })
+}
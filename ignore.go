@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const ignoreFileName = ".splitcopyignore"
+
+type ignoreRule struct {
+	Glob
+	negate bool
+}
+
+// readIgnoreFile parses a .splitcopyignore file. The syntax follows
+// .gitignore: one pattern per line, # comments, and ! to re-include.
+func readIgnoreFile(name string) ([]ignoreRule, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var rules []ignoreRule
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimRight(scanner.Text(), " \t\r")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		var r ignoreRule
+		if rest, ok := strings.CutPrefix(line, "!"); ok {
+			r.negate = true
+			line = rest
+		}
+		line = strings.TrimPrefix(line, `\`) // escaped leading # or !
+		if r.Glob, err = parseGlob(line, true); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", name, n, err)
+		}
+		rules = append(rules, r)
+	}
+	return rules, scanner.Err()
+}
+
+// loadIgnoreFile reads the ignore file of a directory being scanned, if any.
+func (s *Session) loadIgnoreFile(dir, rel string) error {
+	name := filepath.Join(dir, ignoreFileName)
+	rules, err := readIgnoreFile(name)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	if s.ignores == nil {
+		s.ignores = make(map[string][]ignoreRule)
+	}
+	s.ignores[rel] = rules
+	return nil
+}
+
+// ignored checks rel against the ignore files of all its parent
+// directories. Like git, deeper files take precedence and the last
+// matching pattern wins.
+func (s *Session) ignored(rel string, isDir bool) bool {
+	if len(s.ignores) == 0 {
+		return false
+	}
+
+	rel = filepath.ToSlash(rel)
+	var ignored bool
+	dir := "."
+	for {
+		sub := rel
+		if dir != "." {
+			sub = strings.TrimPrefix(rel, dir+"/")
+		}
+		for _, r := range s.ignores[dir] {
+			if r.match(sub, isDir) {
+				ignored = !r.negate
+			}
+		}
+
+		i := strings.IndexByte(sub, '/')
+		if i < 0 {
+			return ignored
+		}
+		if dir == "." {
+			dir = sub[:i]
+		} else {
+			dir += "/" + sub[:i]
+		}
+	}
+}
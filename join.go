@@ -0,0 +1,118 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+type JoinCmd struct {
+	Map    string   `arg:"" help:"The NAME.chunks map saved next to the last part of a file split by --chunk." type:"existingfile"`
+	Output string   `arg:"" help:"File to write, or an existing directory to write it into under its original name." type:"path"`
+	Search []string `placeholder:"DIR" type:"existingdir" help:"Destination roots to look for parts in, e.g. the other disks' mount points. Parts that can't be found are asked for."`
+}
+
+// Run puts a file split by --chunk back together, checking each part
+// against the hash recorded for it.
+func (j *JoinCmd) Run() error {
+	data, err := os.ReadFile(j.Map)
+	if err != nil {
+		return err
+	}
+	var m chunkMap
+	if err := json.Unmarshal(data, &m); err != nil {
+		return fmt.Errorf("%s: %w", j.Map, err)
+	}
+	alg := lookupHash(m.Hash)
+
+	output := j.Output
+	if info, err := os.Stat(output); err == nil && info.IsDir() {
+		output = filepath.Join(output, m.Name)
+	}
+	out, err := os.OpenFile(output, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return err
+	}
+	if err := j.join(out, m, alg); err != nil {
+		out.Close()
+		_ = os.Remove(output)
+		return err
+	}
+	if err := out.Close(); err != nil {
+		_ = os.Remove(output)
+		return err
+	}
+
+	if mode, err := strconv.ParseUint(m.Mode, 8, 32); err == nil {
+		if err := os.Chmod(output, os.FileMode(mode)); err != nil {
+			return err
+		}
+	}
+	if err := os.Chtimes(output, m.Mtime, m.Mtime); err != nil {
+		return err
+	}
+	fmt.Printf("Joined %d parts into %s (%s)\n", len(m.Parts), output, humanBytes(m.Size))
+	return nil
+}
+
+func (j *JoinCmd) join(out *os.File, m chunkMap, alg hashAlg) error {
+	var off int64
+	for _, part := range m.Parts {
+		if part.Offset != off {
+			return fmt.Errorf("%s: part %s starts at %d, expected %d", j.Map, part.Name, part.Offset, off)
+		}
+		path, err := j.findPart(m, part)
+		if err != nil {
+			return err
+		}
+		in, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		h := alg.new()
+		n, err := io.Copy(io.MultiWriter(out, h), in)
+		in.Close()
+		if err != nil {
+			return err
+		}
+		if n != part.Size {
+			return fmt.Errorf("%s: %d bytes, expected %d", path, n, part.Size)
+		}
+		if got := hex.EncodeToString(h.Sum(nil)); got != part.Sum {
+			return fmt.Errorf("%s: %s mismatch", path, alg.name)
+		}
+		off += n
+	}
+	if off != m.Size {
+		return fmt.Errorf("%s: parts add up to %d bytes, expected %d", j.Map, off, m.Size)
+	}
+	return nil
+}
+
+// findPart looks for a part next to the map and under each --search root,
+// then asks for the directory holding it.
+func (j *JoinCmd) findPart(m chunkMap, part chunkPart) (string, error) {
+	dirs := []string{filepath.Dir(j.Map)}
+	for _, root := range j.Search {
+		dirs = append(dirs, filepath.Join(root, filepath.FromSlash(m.Dir)), root)
+	}
+	for {
+		for _, dir := range dirs {
+			path := filepath.Join(dir, part.Name)
+			if _, err := os.Stat(path); err == nil {
+				return path, nil
+			}
+		}
+
+		fmt.Printf("\nCan't find %s (disk %d). Enter the directory holding it:\n", part.Name, part.Disk)
+		dir, err := readDirectory("")
+		if err != nil {
+			return "", err
+		}
+		dirs = append(dirs, filepath.Join(dir, filepath.FromSlash(m.Dir)), dir)
+	}
+}
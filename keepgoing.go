@@ -0,0 +1,51 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+)
+
+// failure is a file left out by --keep-going, or because it couldn't be
+// piped, linked, or cloned.
+type failure struct {
+	rel string
+	err error
+}
+
+// skipFailed records a file that failed for a reason other than its
+// destination, such as an unreadable source, and reports whether the run
+// goes on without it: with --keep-going, or after --file-timeout. The file
+// isn't marked done, so it stays in the remaining list.
+func (s *Session) skipFailed(rel string, err error) bool {
+	var de *destError
+	if !s.args.KeepGoing && !errors.Is(err, errStalled) || errors.As(err, &de) {
+		return false
+	}
+	s.recordFailure(rel, err)
+	return true
+}
+
+// recordFailure reports a file left out of the run. It isn't marked done,
+// so it stays in the remaining list, and the run ends with an error.
+func (s *Session) recordFailure(rel string, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fmt.Fprintf(s.out, "\r%s: %v\033[K\n", rel, err)
+	s.progress.Errors++
+	s.progress.Failed++
+	s.failures = append(s.failures, failure{rel, err})
+	s.emit(Event{Type: EventError, Path: rel, Detail: err.Error()})
+	s.placed = append(s.placed, placement{rel: rel})
+}
+
+// saveFailures writes the files left out by --keep-going, each with its
+// error after a tab, to SOURCE.errors.
+func (s *Session) saveFailures() {
+	s.mu.Lock()
+	lines := make([]string, len(s.failures))
+	for i, f := range s.failures {
+		lines[i] = f.rel + "\t" + f.err.Error()
+	}
+	s.mu.Unlock()
+	s.savePaths(".errors", "Failed", lines)
+}
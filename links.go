@@ -0,0 +1,127 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// What to do with symlinks in the source
+const (
+	linksCopy   = "copy"
+	linksFollow = "follow"
+	linksSkip   = "skip"
+)
+
+var errLinkFailed = errors.New("can't create symlink")
+
+// statSource stats a source path, following a symlink only with
+// --links follow.
+func (f *ScanFlags) statSource(path string) (fs.FileInfo, error) {
+	if f.Links == linksFollow {
+		return os.Stat(path)
+	}
+	return os.Lstat(path)
+}
+
+// followLink decides what the scan does with a symlink under --links skip
+// or follow. It reports whether the link points to a directory to walk
+// into and whether to keep it at all. Broken links and links to one of
+// their own parent directories are reported and left out.
+func (s *Session) followLink(path, rel string) (isDir, keep bool) {
+	if s.args.Links == linksSkip {
+		s.mu.Lock()
+		s.progress.SkippedLinks++
+		s.mu.Unlock()
+		return false, false
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		target, _ := os.Readlink(path)
+		s.mu.Lock()
+		s.progress.SkippedLinks++
+		fmt.Fprintf(s.out, "\rbroken symlink not copied: %s -> %s\033[K\n", rel, target)
+		s.mu.Unlock()
+		return false, false
+	}
+	if !info.IsDir() {
+		return false, true
+	}
+
+	target, err1 := filepath.EvalSymlinks(path)
+	parent, err2 := filepath.EvalSymlinks(filepath.Dir(path))
+	sep := string(filepath.Separator)
+	if err1 != nil || err2 != nil || strings.HasPrefix(parent+sep, strings.TrimSuffix(target, sep)+sep) {
+		s.mu.Lock()
+		s.progress.SkippedLinks++
+		fmt.Fprintf(s.out, "\rsymlink loop not followed: %s\033[K\n", rel)
+		s.mu.Unlock()
+		return true, false
+	}
+	return true, true
+}
+
+// copyLink recreates the symlink src at each of dsts with the same target,
+// owner, and timestamps. Destinations found unable to hold symlinks, such
+// as FAT, are left without them; if one fails anyway, that fails the file
+// rather than the disk.
+func (s *Session) copyLink(src string, dsts []string) (res copyResult, err error) {
+	sInfo, err := os.Lstat(src)
+	if err != nil {
+		return res, err
+	}
+	target, err := os.Readlink(src)
+	if err != nil {
+		return res, err
+	}
+
+	for i, dst := range dsts {
+		if err := s.mkdirAll(filepath.Dir(dst)); err != nil {
+			return res, &destError{i, err}
+		}
+		caps := s.capsOf(dst)
+		if !caps.symlinks {
+			s.mu.Lock()
+			s.progress.SkippedLinks++
+			s.mu.Unlock()
+			continue
+		}
+		_ = os.Remove(dst)
+		if err := os.Symlink(target, dst); err != nil {
+			if isNoSpace(err) {
+				return res, &destError{i, err}
+			}
+			return res, fmt.Errorf("%w: %v", errLinkFailed, err)
+		}
+		if s.args.Preserve.Ownership && caps.chown {
+			copyOwner(dst, sInfo)
+		}
+		if s.args.Preserve.Timestamps && caps.chtimes {
+			_ = lchtimes(dst, fileAtime(sInfo), sInfo.ModTime())
+		}
+	}
+	return res, nil
+}
+
+// compareLinks compares the targets of a source symlink and its copy. It
+// reports false if src isn't a symlink or was copied as a regular file.
+func compareLinks(src, dst string) (string, bool) {
+	sTarget, err := os.Readlink(src)
+	if err != nil {
+		return "", false
+	}
+	dTarget, err := os.Readlink(dst)
+	if _, statErr := os.Lstat(dst); os.IsNotExist(statErr) {
+		return "missing", true
+	} else if err != nil {
+		return "", false
+	}
+	if sTarget != dTarget {
+		return fmt.Sprintf("symlink target mismatch (%s != %s)", sTarget, dTarget), true
+	}
+	return "", true
+}
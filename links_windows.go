@@ -0,0 +1,25 @@
+package main
+
+import (
+	"time"
+
+	"golang.org/x/sys/windows"
+)
+
+// lchtimes sets the timestamps of a symlink itself rather than of what it
+// points to, by opening its reparse point.
+func lchtimes(path string, atime, mtime time.Time) error {
+	p, err := pathPtr(path)
+	if err != nil {
+		return err
+	}
+	h, err := windows.CreateFile(p, windows.FILE_WRITE_ATTRIBUTES, windows.FILE_SHARE_READ|windows.FILE_SHARE_WRITE|windows.FILE_SHARE_DELETE, nil,
+		windows.OPEN_EXISTING, windows.FILE_FLAG_BACKUP_SEMANTICS|windows.FILE_FLAG_OPEN_REPARSE_POINT, 0)
+	if err != nil {
+		return err
+	}
+	defer windows.CloseHandle(h)
+	a := windows.NsecToFiletime(atime.UnixNano())
+	m := windows.NsecToFiletime(mtime.UnixNano())
+	return windows.SetFileTime(h, nil, &a, &m)
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// logLevels is the verbosity at which each event type is logged. Problems
+// and destination changes are always logged; -v adds every file and -vv
+// the start of each copy and the end of the scan.
+var logLevels = map[string]int{
+	EventCopied:  1,
+	EventSkipped: 1,
+	EventStarted: 2,
+	EventScanned: 2,
+}
+
+// logSink writes events as logfmt lines (key=value pairs) for an audit
+// trail of the run.
+type logSink struct {
+	mu    sync.Mutex
+	w     io.Writer
+	level int
+	tty   bool // clear the progress line before each entry
+}
+
+func (l *logSink) emit(e Event) {
+	if logLevels[e.Type] > l.level {
+		return
+	}
+
+	var b strings.Builder
+	if l.tty {
+		b.WriteString("\r")
+	}
+	fmt.Fprintf(&b, "time=%s type=%s", time.Now().Format(time.RFC3339Nano), e.Type)
+	if e.Path != "" {
+		fmt.Fprintf(&b, " path=%s", logfmtValue(e.Path))
+	}
+	if e.Bytes != 0 {
+		fmt.Fprintf(&b, " bytes=%d", e.Bytes)
+	}
+	if e.Detail != "" {
+		fmt.Fprintf(&b, " detail=%s", logfmtValue(e.Detail))
+	}
+	if e.Duration != 0 {
+		fmt.Fprintf(&b, " seconds=%.3f", e.Duration.Seconds())
+	}
+	if l.tty {
+		b.WriteString("\033[K")
+	}
+	b.WriteString("\n")
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	io.WriteString(l.w, b.String())
+}
+
+// logfmtValue quotes values that contain spaces, quotes, or '='.
+func logfmtValue(v string) string {
+	if strings.ContainsAny(v, " \t\n\"=\\") {
+		return strconv.Quote(v)
+	}
+	return v
+}
+
+// openLog appends to --log-file, or logs to the terminal output when only
+// -v is given.
+func (s *Session) openLog() error {
+	switch {
+	case s.args.LogFile != "":
+		f, err := os.OpenFile(s.args.LogFile, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(f, "time=%s type=run source=%s destination=%s\n", time.Now().Format(time.RFC3339Nano), logfmtValue(s.args.Source), logfmtValue(s.args.Destination))
+		s.sinks = append(s.sinks, &logSink{w: f, level: s.args.Verbose})
+	case s.args.Verbose > 0:
+		s.sinks = append(s.sinks, &logSink{w: s.out, level: s.args.Verbose, tty: s.isTTY})
+	}
+	return nil
+}
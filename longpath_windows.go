@@ -0,0 +1,37 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/sys/windows"
+)
+
+// maxShortPath is the longest path Windows APIs reliably take without the
+// extended-length prefix: MAX_PATH less room for an 8.3 file name.
+const maxShortPath = 248
+
+// longPath returns path in its extended-length form, \\?\C:\dir\name or
+// \\?\UNC\server\share\dir\name, if it is too long for MAX_PATH. The os
+// package does this for its own calls; this is for the Windows APIs
+// splitcopy calls directly. The extended form skips normalization, so the
+// path is made absolute and cleaned first. Device paths and paths that
+// are already extended are left alone.
+func longPath(path string) string {
+	if strings.HasPrefix(path, `\\?\`) || strings.HasPrefix(path, `\\.\`) {
+		return path
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil || len(abs) < maxShortPath {
+		return path
+	}
+	if strings.HasPrefix(abs, `\\`) {
+		return `\\?\UNC\` + abs[2:]
+	}
+	return `\\?\` + abs
+}
+
+// pathPtr converts path for a Windows API call, extending it if needed.
+func pathPtr(path string) (*uint16, error) {
+	return windows.UTF16PtrFromString(longPath(path))
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// macFlags are the BSD file flags copied with --mac-metadata. The others
+// either can't be set (compressed, tracked) or would stop the copy being
+// renamed into place (immutable, append-only).
+const macFlags = unix.UF_HIDDEN | unix.UF_NODUMP
+
+func checkMacMetadata() error { return nil }
+
+// copyMacMetadata copies what copyfile(3) calls metadata from src to dst,
+// short of ACLs, which would need libc: every extended attribute, which on
+// macOS holds the resource fork, Finder info, tags, and the quarantine
+// flag, and the hidden flag. Attributes the destination can't hold are
+// returned, as with copyXattrs.
+func copyMacMetadata(src, dst string) (lost []string, err error) {
+	names, err := listXattrs(src)
+	if err != nil && !isUnsupported(err) {
+		return nil, err
+	}
+	if lost, err = setXattrs(src, dst, names); err != nil {
+		return lost, err
+	}
+
+	var st unix.Stat_t
+	if err := unix.Lstat(src, &st); err != nil {
+		return lost, &os.PathError{Op: "lstat", Path: src, Err: err}
+	}
+	if flags := int(st.Flags) & macFlags; flags != 0 {
+		if err := unix.Chflags(dst, flags); err != nil && !isUnsupported(err) {
+			return lost, &os.PathError{Op: "chflags", Path: dst, Err: err}
+		}
+	}
+	return lost, nil
+}
@@ -0,0 +1,11 @@
+//go:build !darwin
+
+package main
+
+import "errors"
+
+func checkMacMetadata() error {
+	return errors.New("--mac-metadata is only supported on macOS")
+}
+
+func copyMacMetadata(src, dst string) ([]string, error) { return nil, nil }
@@ -2,15 +2,18 @@ package main
 
 import (
 	"bufio"
-	"bytes"
 	"errors"
 	"fmt"
+	"io"
 	"io/fs"
 	"os"
-	"os/exec"
 	"os/signal"
 	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
@@ -20,56 +23,518 @@ import (
 )
 
 type CLI struct {
+	Copy         CopyCmd         `cmd:"" default:"withargs" help:"Copy source files into one or more destinations (default)."`
+	Verify       VerifyCmd       `cmd:"" help:"Compare a destination tree against the source without writing anything."`
+	Apply        ApplyCmd        `cmd:"" help:"Copy exactly the files listed in a plan file."`
+	Plan         PlanCmd         `cmd:"" help:"Pack the source onto as few disks of a given size as possible and write a file list per disk."`
+	RestoreAttrs RestoreAttrsCmd `cmd:"" help:"Re-apply the mode, owner, mtime, and xattrs recorded in a manifest to an existing tree without copying content."`
+	Join         JoinCmd         `cmd:"" help:"Put a file split by --chunk back together from its parts and check them."`
+}
+
+// ScanFlags select which source paths are processed.
+type ScanFlags struct {
+	ResumeList *os.File `name:"resume" short:"r" placeholder:"FILE" help:"Text file containing relative paths to process."`
+	StartIndex int      `placeholder:"N" help:"Skip the first N scanned paths. Only meaningful with a stable ordering such as a resume list."`
+
+	IncludeHidden bool `xor:"hidden" help:"Include hidden files and directories (default)."`
+	ExcludeHidden bool `xor:"hidden" help:"Skip files and directories whose name starts with a dot."`
+
+	Exclude []Glob `placeholder:"GLOB" help:"Skip files and directories matching this rsync-style pattern, e.g. '*.tmp' or 'node_modules/'. Repeatable."`
+	Include []Glob `placeholder:"GLOB" help:"Don't skip paths matching this pattern even if they match --exclude. Repeatable."`
+
+	Match   []Regex `placeholder:"REGEX" help:"Only include files whose relative path matches this regular expression (RE2 syntax). Repeatable; any may match."`
+	NoMatch []Regex `placeholder:"REGEX" help:"Skip files whose relative path matches this regular expression. Repeatable."`
+
+	NoIgnoreFiles bool `help:"Don't read .splitcopyignore files in the source."`
+
+	MinSize ByteSize `placeholder:"SIZE" help:"Skip files smaller than this, e.g. 10K."`
+	MaxSize ByteSize `placeholder:"SIZE" help:"Skip files larger than this, e.g. 2G."`
+
+	NewerThan TimeBound `placeholder:"TIME|AGE" help:"Only include files modified after this date (2024-05-01) or within this age (30d, 12h)."`
+	OlderThan TimeBound `placeholder:"TIME|AGE" help:"Only include files modified before this date or at least this long ago."`
+
+	Order string `enum:"walk,name,dir,size,mtime" default:"walk" help:"Copy in this order: ${enum}. size is largest first, mtime oldest first, dir keeps each directory's files together. Anything but walk waits for the scan to finish."`
+
+	AllowEmpty bool `help:"Succeed even if no files were selected."`
+
+	ScanCache   string `placeholder:"FILE" type:"path" help:"Reuse the file list saved here by an earlier run if no source directory has changed since, and save it after a full walk."`
+	NoScanCache bool   `help:"Always walk the source, refreshing --scan-cache instead of reading it."`
+
+	Links         string `enum:"copy,follow,skip" default:"copy" help:"Recreate symlinks as symlinks (copy), copy what they point to and walk into linked directories (follow), or leave them out (skip)."`
+	OneFileSystem bool   `short:"x" help:"Don't descend into directories on other filesystems, such as bind mounts, like rsync -x. Mount points are created empty."`
+
+	Specials bool `help:"Recreate FIFOs, sockets, and device nodes (devices need root) instead of leaving them out with a warning."`
+}
+
+type CopyCmd struct {
 	Source      string   `arg:"" help:"Source directory." type:"existingdir"`
 	Destination string   `arg:"" help:"Destination directory." type:"path"`
-	ResumeList  *os.File `name:"resume" short:"r" placeholder:"FILE" help:"Text file containing relative paths to copy."`
+	Next        []string `arg:"" optional:"" help:"More destinations, used in order without prompting whenever the current one is full." type:"path"`
+
+	ScanFlags `embed:""`
+	CopyFlags `embed:""`
+}
+
+// CopyFlags control how files are copied. They are shared by copy and apply.
+type CopyFlags struct {
+	MirrorTo     string  `placeholder:"DEST2" type:"path" help:"Write every file to a second destination from the same read."`
+	Sums         bool    `help:"Keep a SHA256SUMS file (or XXH3SUMS or B3SUMS, see --hash) in the root of each destination listing the files copied to it, for checking with sha256sum -c years later."`
+	Hash         string  `enum:"sha256,xxh3,blake3" default:"sha256" help:"Hash used by --verify, --verify-tree, --checksum, --sums, and manifests: ${enum}. xxh3 is much faster but only detects accidental corruption."`
+	Par2         Percent `name:"par2" placeholder:"PCT%" help:"Create par2 recovery data of this size (e.g. 10%) for the files on each destination once it is done, leaving room for it as the disk fills. Needs par2cmdline."`
+	Verify       bool    `help:"Read each file back from the destination right after writing it and compare its hash with the source's. Files that don't match are left for --resume."`
+	VerifyTree   bool    `help:"After copying, compare every file against the source (presence, size, and hash)."`
+	VerifyPolicy string  `default:"end" enum:"end,swap,background,deferred" help:"When --verify-tree checks each destination: at the end of the run, before each disk swap, in the background after a swap, or deferred to a later verify run (${enum})."`
+	TwoPass      bool    `help:"Create the directory tree with empty placeholder files first, then fill in content."`
+
+	Delete            bool `help:"After copying, delete files (and then empty directories) from the destination that aren't in the source, for one-way sync to a single disk. Files excluded by filters are kept."`
+	RemoveSourceFiles bool `help:"Delete each source file once it has been copied (and passed --verify, if given). Directories are left in place."`
+	Trash             bool `help:"With --remove-source-files, move source files to the trash (freedesktop.org trash on Linux, ~/.Trash on macOS, the Recycle Bin on Windows) instead of deleting them."`
+
+	Preserve    Preserve `default:"mode,ownership,timestamps" placeholder:"ATTRS" help:"Metadata to copy, like cp: mode, ownership, timestamps, xattr, acl, links (hard links), all, or none. Comma-separated."`
+	NoEmptyDirs bool     `help:"Don't recreate source directories that have no files to copy, like rsync -m."`
+	HardLinks   bool     `short:"H" help:"Recreate hard links between source files at the destination instead of copying their content again, when the links end up on the same disk. Same as --preserve=links."`
+
+	RequireSameDevice bool `help:"Refuse to run unless the destination is on the same filesystem as the source."`
+
+	DryRun         bool   `short:"n" help:"Show which files would be copied to which destination, and where full destinations would be switched, without writing anything."`
+	DryRunManifest string `placeholder:"FILE" type:"path" help:"Don't copy anything; write a JSON lines manifest of the selected source files (path, size, mode, owner, mtime, and xattrs with --xattrs) to FILE."`
+	DryRunHash     bool   `help:"Include hashes (--hash, SHA-256 by default) in --dry-run-manifest. Reads every byte of the source."`
+
+	SkipExisting     bool          `xor:"skip" help:"Skip files that already exist at the destination with the same size and mtime, e.g. when re-running into a partly filled disk."`
+	Update           bool          `short:"u" help:"Don't overwrite destination files that are as new as the source or newer, like cp -u."`
+	Checksum         bool          `short:"c" xor:"skip" help:"Skip files that already exist at the destination with the same hash (see --hash), for destinations with unreliable mtimes. Reads both copies in full."`
+	RenameCollisions bool          `help:"When two source files would be written to the same destination name, give the later one a \" (1)\" suffix instead of overwriting the first. Each rename is logged."`
+	OnConflict       string        `enum:"overwrite,skip,rename,prompt,error" default:"overwrite" help:"What to do when a file already exists at the destination: ${enum}. rename writes \"name (1).ext\" beside it; prompt shows both copies and asks each time."`
+	Normalize        string        `enum:"none,nfc,nfd" default:"none" help:"Unicode normalization for destination names: ${enum}. Use nfc when copying from macOS, which stores accented names decomposed, so the copies match names typed on other systems; --skip-existing, --delete, and verify compare names the same way."`
+	Sanitize         bool          `help:"Rewrite names that FAT, exFAT, and NTFS can't store: the characters : ? * \" < > | \\ and control characters become lookalikes, a trailing dot or space is replaced, and reserved names such as CON and NUL get an underscore. Renamed files are listed in splitcopy-names.tsv on each destination."`
+	ManifestDiff     string        `placeholder:"FILE" type:"existingfile" help:"Only copy files that are missing from, or differ in size or hash from, this destination manifest (JSON lines or sha256sum output). Entries without a hash are compared by size and mtime."`
+	StrictMtime      bool          `xor:"mtime" help:"Compare mtimes to the nanosecond."`
+	MtimeTolerance   time.Duration `xor:"mtime" placeholder:"DURATION" help:"Treat mtimes at most this far apart as equal (default: the timestamp resolution of the destination filesystem)."`
+
+	PipeThrough string `placeholder:"CMD" help:"Stream each file through a shell command, e.g. \"gpg -e -r me\", and write its output instead."`
+	PipeSuffix  string `placeholder:"EXT" help:"Append this suffix to destination names when using --pipe-through, e.g. .gpg."`
+
+	ControlFile string `placeholder:"PATH" type:"path" help:"Pause after the files in progress when this file is created or touched, and resume when it is touched again. SIGUSR2 does the same, except on Windows."`
+
+	ReportSlowest   int    `placeholder:"N" help:"At the end, list the N files and directories that took longest to copy."`
+	BandwidthReport string `placeholder:"FILE" type:"path" help:"Write a CSV throughput sample to this file at every progress update."`
+
+	Jobs               int      `short:"j" placeholder:"N" help:"Number of files to copy in parallel (default: 1, or the --media-type preset)."`
+	LargeFileThreshold ByteSize `placeholder:"SIZE" help:"Treat files at least this big as large and limit how many are copied at once (see --large-file-jobs)."`
+	LargeFileJobs      int      `default:"1" help:"Maximum number of large files copied concurrently so small files aren't stuck behind them."`
+	MaxOpenFiles       int      `placeholder:"N" help:"Maximum file descriptors held open across all workers (default: half the soft ulimit)."`
+	MediaType          string   `enum:"none,auto,hdd,ssd,nvme,network" default:"none" help:"Tune buffer size, --jobs, and readahead for the destination: ${enum}. auto detects it (Linux: from /sys/block)."`
+	Nice               int      `placeholder:"N" help:"Lower splitcopy's CPU priority by N (1-19), like nice(1)."`
+	Ionice             string   `enum:"none,idle,best-effort" default:"none" help:"I/O scheduling class, like ionice(1): ${enum}. idle only gets the disk when nothing else wants it; best-effort uses the lowest priority within the normal class."`
+	Bwlimit            ByteSize `placeholder:"RATE" help:"Limit the total copy rate across all jobs to RATE bytes per second, e.g. 50M."`
+	Engine             string   `enum:"default,uring" default:"default" help:"How file data is moved: ${enum}. uring (Linux 5.6+) queues reads and writes on an io_uring, saving syscalls on fast NVMe copies of many small files."`
+	BufferSize         ByteSize `placeholder:"SIZE" help:"Size of each of the two copy buffers, one being read while the other is written (default: 128KiB, or the --media-type preset)."`
+
+	ConfirmOverwriteThreshold Threshold `placeholder:"N|PCT%" help:"Ask before copying if more than this many (or this percentage of) files already exist at the destination. Waits for the scan to finish."`
+	Yes                       bool      `short:"y" help:"Don't ask for confirmation."`
+	Force                     bool      `help:"Copy even if a destination is inside the source or contains it."`
+
+	LogFile string `placeholder:"FILE" type:"path" help:"Append a logfmt audit log of errors, full disks, and destination changes to FILE; -v adds every copied and skipped file."`
+	Verbose int    `short:"v" type:"counter" help:"Log every copied and skipped file; -vv also logs when each copy starts. Without --log-file the log goes to the terminal."`
+
+	SummaryFile string `placeholder:"FILE" type:"path" help:"When the run ends, even on interrupt, write a JSON summary (files and bytes copied, files remaining, errors, elapsed time, destinations used) to FILE."`
+
+	Porcelain  bool   `help:"Print stable tab-separated event lines to stdout for scripts; human output moves to stderr."`
+	JSONEvents string `name:"json-events" xor:"events" placeholder:"FILE" help:"Write one JSON object per event (file started and copied, destination full or changed, scan finished) to FILE, or - for stdout."`
+	EventsFD   int    `name:"events-fd" xor:"events" placeholder:"N" help:"Write the --json-events stream to this already open file descriptor."`
+
+	Reflink       string        `enum:"auto,always,never" default:"auto" help:"Clone files on copy-on-write filesystems (btrfs, XFS, APFS) so they share the source's blocks: when possible (auto), or fail files that can't be (always)."`
+	Direct        bool          `help:"Bypass the page cache (O_DIRECT, or F_NOCACHE on macOS) for multi-terabyte copies that would otherwise push everything else out of memory. Sparse files are copied in full."`
+	Fsync         string        `enum:"per-file,per-dir,end,never" default:"per-file" help:"When to flush copies to the device: each file and its directory entry before it counts as done (per-file), each file and its directories once the destination is finished (per-dir), the whole filesystem once the destination is finished (end), or never."`
+	Inplace       bool          `help:"Write each file under its final name from the start, instead of to a temporary .NAME.splitcopy.tmp that is synced and renamed into place once complete."`
+	Partial       bool          `help:"Keep a file that runs out of space as NAME.splitcopy-partial, and continue it from where it stopped when it's copied to that destination again."`
+	PartialCheck  ByteSize      `default:"1MiB" placeholder:"SIZE" help:"Compare this much of the end of a --partial file with the source before continuing it."`
+	Salvage       bool          `help:"Rescue what can be read from a failing source disk: skip --salvage-block bytes past each read error, write them as zeros, and list the damaged ranges in SOURCE.damaged."`
+	SalvageBlock  ByteSize      `default:"64KiB" placeholder:"SIZE" help:"How far --salvage skips ahead after a read error."`
+	FileTimeout   time.Duration `placeholder:"DURATION" help:"Give up on a file whose data has made no progress for this long, e.g. on a hard-mounted NFS server that went away, and go on with the next one. The file is listed in SOURCE.errors; --retries tries it again first."`
+	KeepGoing     bool          `help:"Don't stop at a file that can't be read: list it with its error in SOURCE.errors and in the remaining-files list, copy the rest, and exit with an error at the end."`
+	Retries       int           `placeholder:"N" help:"Try a file again up to N times after a transient I/O error (EIO, ETIMEDOUT, a dropped network mount) before giving up on the destination. With --partial, retries continue where the copy stopped."`
+	RetryDelay    time.Duration `default:"5s" placeholder:"DURATION" help:"Wait this long before the first retry, doubling each time up to 5 minutes."`
+	Chunk         bool          `help:"Split a file that doesn't fit in the space left into parts (NAME.part001, ...) across destinations, with a NAME.chunks map for splitcopy join."`
+	Pack          string        `enum:"order,greedy" default:"order" help:"Switch destinations at the first file that doesn't fit (order), or hold such files back for the next destination and keep filling this one with smaller files (greedy)."`
+	Reserve       Reserve       `placeholder:"SIZE" help:"Treat a destination as full once this much space would be left on it, as a size (20G) or a percentage of the filesystem (5%)."`
+	NoCache       bool          `help:"Drop copied data from the page cache as the copy goes, so copying terabytes doesn't push everything else out of memory. Unlike --direct, reads and writes still go through the cache."`
+	NoPreallocate bool          `help:"Don't reserve space for each file before copying it. Reserving it makes a file that won't fit fail before any of it is written."`
+	Sparse        string        `enum:"auto,always,never" default:"auto" help:"Keep holes in sparse source files (auto), also turn blocks of zeros into holes (always), or write every byte (never)."`
+	SparseMinSize ByteSize      `default:"64KiB" placeholder:"SIZE" help:"Skip hole detection for files smaller than this."`
+
+	Streams     bool `help:"Copy named streams such as macOS resource forks and NTFS alternate data streams (on Windows, or via ntfs-3g on Linux) where the destination supports them."`
+	ACLs        bool `name:"acls" help:"Copy POSIX access ACLs (Linux only) where the destination supports them. Same as --preserve=acl."`
+	Xattrs      bool `help:"Copy extended attributes, such as user.* tags, where the destination supports them. Attributes that can't be set are reported and skipped. Same as --preserve=xattr."`
+	MacMetadata bool `help:"Copy the metadata copyfile(3) copies on macOS, except ACLs: resource forks, Finder info and tags, quarantine and every other extended attribute, and the hidden flag, for files and directories (macOS only)."`
+
+	Chmod ChmodSpec `placeholder:"MODE" help:"Set destination permissions instead of preserving them, e.g. 644 or D755,F644."`
+	Umask Umask     `placeholder:"MASK" help:"Clear these octal permission bits from preserved modes, e.g. 022."`
 }
 
 func main() {
-	var args CLI
-	kong.Parse(&args)
+	var cli CLI
+	ctx := kong.Parse(&cli)
+
+	if err := ctx.Run(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		var ee *exitError
+		if errors.As(err, &ee) {
+			os.Exit(ee.code)
+		}
+		os.Exit(1)
+	}
+}
+
+// exitError carries a specific process exit status.
+type exitError struct {
+	code int
+	err  error
+}
+
+func (e *exitError) Error() string { return e.err.Error() }
+func (e *exitError) Unwrap() error { return e.err }
+
+const exitNothingSelected = 3
+
+var errNothingSelected = &exitError{exitNothingSelected, errors.New("no files matched the filters (use --allow-empty to accept this)")}
+
+// checkSelected fails runs that found nothing to do, which usually means
+// a filter or resume list was wrong.
+func (s *Session) checkSelected(startIndex int) error {
+	if !s.args.AllowEmpty && len(s.allPaths) <= startIndex {
+		return errNothingSelected
+	}
+	return nil
+}
+
+func (f *ScanFlags) validate() error {
+	if f.StartIndex < 0 {
+		return errors.New("--start-index can't be negative")
+	}
+	return nil
+}
+
+func (c *CopyCmd) Validate() error {
+	if err := c.ScanFlags.validate(); err != nil {
+		return err
+	}
+	if c.Delete && (c.ResumeList != nil || c.StartIndex > 0) {
+		return errors.New("--delete needs a full scan of the source, not --resume or --start-index")
+	}
+	if c.Delete && (len(c.Next) > 0 || c.Chunk) {
+		return errors.New("--delete is for a single destination, but more were given")
+	}
+	return c.CopyFlags.validate()
+}
+
+func (c *CopyFlags) validate() error {
+	if c.VerifyPolicy == "deferred" && c.PipeThrough != "" {
+		return errors.New("--verify-policy=deferred can't be used with --pipe-through: the verify command can't check transformed files")
+	}
+	if c.Trash && !c.RemoveSourceFiles {
+		return errors.New("--trash only applies with --remove-source-files")
+	}
+	if c.RemoveSourceFiles && (c.VerifyTree || c.TwoPass) {
+		return errors.New("--remove-source-files can't be used with --verify-tree or --two-pass, which read the source again later; use --verify instead")
+	}
+	if c.keepACLs() {
+		if err := checkACLs(); err != nil {
+			return err
+		}
+		if c.Chmod.HasFile || c.Umask != 0 {
+			return errors.New("--acls can't be used with --chmod or --umask: the copied ACL would put the original permissions back")
+		}
+	}
+	if c.MacMetadata {
+		if err := checkMacMetadata(); err != nil {
+			return err
+		}
+	}
+	if c.Chunk && (c.MirrorTo != "" || c.PipeThrough != "" || c.TwoPass || c.Par2 > 0) {
+		return errors.New("--chunk can't be used with --mirror-to, --pipe-through, --two-pass, or --par2")
+	}
+	if c.OnConflict != conflictOverwrite && c.TwoPass {
+		return errors.New("--on-conflict can't be used with --two-pass, whose placeholders would conflict with every file")
+	}
+	if c.Salvage && (c.SalvageBlock <= 0 || c.Direct && c.SalvageBlock%directAlign != 0) {
+		return errors.New("--salvage-block must be more than 0, and a multiple of 4KiB with --direct")
+	}
+	if (c.SkipExisting || c.Checksum) && c.PipeThrough != "" {
+		return errors.New("--skip-existing and --checksum can't be used with --pipe-through: transformed files never match the source")
+	}
+	return nil
+}
+
+func (c *CopyCmd) Run() error {
+	return newSession(c).Run()
+}
 
+func newSession(args *CopyCmd) *Session {
+	// On Windows, Ctrl+C and Ctrl+Break arrive as os.Interrupt and closing
+	// the console window, logging off, or shutting down as SIGTERM
 	sigIntChan := make(chan os.Signal, 1)
 	signal.Notify(sigIntChan, os.Interrupt, syscall.SIGTERM)
 
 	sess := &Session{
-		args:       &args,
-		sigIntChan: sigIntChan,
+		args:          args,
+		sigIntChan:    sigIntChan,
+		out:           os.Stdout,
+		timings:       newTimings(args.ReportSlowest),
+		fds:           newFDSemaphore(args.MaxOpenFiles),
+		limiter:       newRateLimiter(int64(args.Bwlimit)),
+		hash:          lookupHash(args.Hash),
+		scanned:       make(chan struct{}, 1),
+		scanDone:      make(chan struct{}),
+		done:          make(map[int]bool),
+		claimed:       make(map[string]string),
+		caps:          make(map[string]destCaps),
+		links:         make(map[inode]placement),
+		inodes:        make(map[string]inode),
+		linking:       make(map[inode]string),
+		nestedSources: make(map[string]string),
+		placeholders:  make(map[string]int),
+		stopCh:        make(chan struct{}),
+		began:         time.Now(),
 		progress: Progress{
-			start:   time.Now(),
-			diskNum: 2,
+			start:         time.Now(),
+			diskNum:       2,
+			mirrorDiskNum: 2,
 		},
 	}
 
-	sess.watchResize()
+	sess.pauseCond = sync.NewCond(&sess.mu)
 
-	if err := sess.Run(); err != nil {
-		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-		os.Exit(1)
+	if args.Porcelain {
+		sess.out = os.Stderr
+		sess.sinks = append(sess.sinks, newPorcelainSink(os.Stdout))
 	}
+
+	if f, ok := sess.out.(*os.File); ok {
+		sess.isTTY = term.IsTerminal(int(f.Fd()))
+		if sess.isTTY {
+			enableEscapes(f)
+		}
+	}
+	sess.watchResize()
+	return sess
 }
 
-func (s *Session) scan(paths chan<- string, errCh chan<- error) {
-	defer close(paths)
+func (s *Session) scan() {
+	defer close(s.scanDone)
+	defer func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.emit(Event{Type: EventScanned, Bytes: s.scanTotal.Bytes, Detail: strconv.FormatInt(s.scanTotal.Files, 10)})
+	}()
+	if s.ordered() {
+		defer s.publishOrdered()
+	}
+
+	if s.paths != nil {
+		for _, rel := range s.paths {
+			s.addSelected(rel, nil)
+		}
+		return
+	}
 
 	if s.args.ResumeList != nil {
 		defer s.args.ResumeList.Close()
 		scanner := bufio.NewScanner(s.args.ResumeList)
 		for scanner.Scan() {
-			paths <- scanner.Text()
+			rel := scanner.Text()
+			if strings.HasPrefix(rel, planHeader) {
+				continue
+			}
+			if s.args.ExcludeHidden && isHiddenPath(rel) || s.args.excludedPath(rel) {
+				continue
+			}
+			s.addSelected(rel, nil)
 		}
-		errCh <- scanner.Err()
+		s.scanErr = scanner.Err()
+		return
+	}
+
+	if s.loadScanCache() {
 		return
 	}
 
-	errCh <- filepath.WalkDir(s.args.Source, func(path string, d fs.DirEntry, err error) error {
-		if err != nil || d.IsDir() {
+	var cache *scanCache
+	if s.args.ScanCache != "" {
+		cache = &scanCache{
+			Version:       scanCacheVersion,
+			Source:        s.args.Source,
+			ExcludeHidden: s.args.ExcludeHidden,
+			Filters:       s.args.filterKey(),
+			NoIgnoreFiles: s.args.NoIgnoreFiles,
+			Dirs:          make(map[string]int64),
+			IgnoreFiles:   make(map[string]int64),
+		}
+	}
+
+	var rootDev uint64
+	if s.args.OneFileSystem {
+		dev, err := deviceOf(s.args.Source)
+		if err != nil {
+			s.scanErr = err
+			return
+		}
+		rootDev = dev
+	}
+
+	var visit fs.WalkDirFunc
+	visit = func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
 			return err
 		}
 		rel, _ := filepath.Rel(s.args.Source, path)
-		paths <- rel
+		if path != s.args.Source && (s.args.ExcludeHidden && isHidden(d.Name()) || s.args.excluded(rel, d.IsDir()) || s.ignored(rel, d.IsDir()) || s.args.Trash && isTrashDir(rel)) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.Type()&fs.ModeSymlink != 0 && s.args.Links != linksCopy {
+			isDir, keep := s.followLink(path, rel)
+			if !keep {
+				return nil
+			} else if isDir {
+				return filepath.WalkDir(path+string(filepath.Separator), visit)
+			}
+			d = nil // stat the target, not the link
+		}
+		if d != nil && d.IsDir() && slices.Contains(s.nestedDests, rel) {
+			return filepath.SkipDir // --force with a destination inside the source
+		}
+		if d != nil && d.IsDir() {
+			if rel != "." {
+				s.mu.Lock()
+				s.scanDirs = append(s.scanDirs, rel)
+				s.mu.Unlock()
+			}
+			if rootDev != 0 && rel != "." {
+				if dev, err := deviceOf(path); err == nil && dev != rootDev {
+					// Left as an empty mount point, like rsync -x
+					fmt.Fprintf(s.out, "\rnot crossing into another filesystem: %s\033[K\n", rel)
+					return filepath.SkipDir
+				}
+			}
+			if cache != nil {
+				info, err := d.Info()
+				if err != nil {
+					return err
+				}
+				cache.Dirs[rel] = info.ModTime().UnixNano()
+			}
+			if !s.args.NoIgnoreFiles {
+				if err := s.loadIgnoreFile(path, filepath.ToSlash(rel)); err != nil {
+					return err
+				}
+				if cache != nil && s.ignores[filepath.ToSlash(rel)] != nil {
+					info, err := os.Stat(filepath.Join(path, ignoreFileName))
+					if err != nil {
+						return err
+					}
+					cache.IgnoreFiles[rel] = info.ModTime().UnixNano()
+				}
+			}
+			return nil
+		}
+		if cache != nil {
+			cache.Files = append(cache.Files, rel)
+		}
+		s.addSelected(rel, d)
 		return nil
-	})
+	}
+	s.scanErr = filepath.WalkDir(s.args.Source, visit)
+
+	if cache != nil && s.scanErr == nil {
+		if err := cache.write(s.args.ScanCache); err != nil {
+			fmt.Fprintf(s.out, "failed to write scan cache: %v\n", err)
+		}
+	}
+}
+
+// addPath publishes a scanned path to the workers and adds its size to the
+// running totals. info may be nil if the file couldn't be stat'd.
+func (s *Session) addPath(rel string, info fs.FileInfo) {
+	s.noteInode(rel, info)
+	key := orderKey{rel: rel}
+	if info != nil {
+		key.size, key.mtime = info.Size(), info.ModTime()
+	}
+	if s.ordered() {
+		s.pending = append(s.pending, key)
+		return
+	}
+
+	s.mu.Lock()
+	s.allPaths = append(s.allPaths, rel)
+	s.countScanned(len(s.allPaths)-1, key.size)
+	s.mu.Unlock()
+
+	select {
+	case s.scanned <- struct{}{}:
+	default:
+	}
+}
+
+// countScanned adds the i-th scanned path to scanTotal unless it comes
+// before --start-index. The caller must hold s.mu.
+func (s *Session) countScanned(i int, size int64) {
+	if i >= s.args.StartIndex {
+		s.scanTotal.Files++
+		s.scanTotal.Bytes += size
+	}
+}
+
+func (s *Session) ordered() bool {
+	return s.args.Order != "" && s.args.Order != "walk"
+}
+
+var errInterrupted = errors.New("interrupted")
+
+// waitPath blocks until the i-th path has been scanned. It returns false
+// once the scan has finished without reaching i.
+func (s *Session) waitPath(i int, stop <-chan struct{}) (string, bool, error) {
+	for {
+		s.mu.Lock()
+		n := len(s.allPaths)
+		var rel string
+		if i < n {
+			rel = s.allPaths[i]
+		}
+		s.mu.Unlock()
+		if i < n {
+			return rel, true, nil
+		}
+
+		select {
+		case <-s.scanDone:
+			s.mu.Lock()
+			n = len(s.allPaths)
+			s.mu.Unlock()
+			if i >= n {
+				return "", false, s.scanErr
+			}
+		case <-s.scanned:
+		case <-stop:
+			return "", false, errInterrupted
+		}
+	}
+}
+
+func isHidden(name string) bool {
+	return len(name) > 1 && name[0] == '.' && name != ".."
+}
+
+func isHiddenPath(rel string) bool {
+	for _, part := range strings.Split(filepath.ToSlash(rel), "/") {
+		if isHidden(part) {
+			return true
+		}
+	}
+	return false
 }
 
 type Stats struct {
@@ -77,144 +542,806 @@ type Stats struct {
 	Bytes int64
 }
 
+type SparseStats struct {
+	Files int64
+	Holes int64
+	Bytes int64
+}
+
 type Progress struct {
-	Global        Stats
-	Local         Stats
-	start         time.Time
-	lastPrintTime time.Time
-	diskNum       int
+	Global          Stats
+	Local           Stats
+	Skipped         Stats
+	Sparse          SparseStats
+	Linked          Stats // hard links recreated instead of copied
+	Cloned          Stats // reflinked instead of copied
+	Chunked         Stats // split into parts by --chunk
+	ChunkParts      int64
+	SkippedLinks    int64 // symlinks left out by --links skip or follow
+	SkippedSpecials int64 // FIFOs, sockets, and devices left out without --specials
+	LostStreams     int64
+	LostXattrs      int64
+	LostACLs        int64
+	Errors          int64
+	Retries         int64 // attempts repeated after a transient error
+	Failed          int64 // files left out by --keep-going, or that couldn't be piped, linked, or cloned
+	Damaged         Stats // copied by --salvage with unreadable ranges; Bytes counts those
+	VerifyFailed    int64 // files whose copy didn't match when read back
+	start           time.Time
+	lastPrintTime   time.Time
+	pausedAt        time.Time // zero unless paused
+	pausedFor       time.Duration
+	active          int // files being copied right now
+	rate            rateWindow
+	diskNum         int
+	mirrorDiskNum   int
 }
 
 type Session struct {
-	args       *CLI
+	args       *CopyCmd
 	sigIntChan chan os.Signal
+	out        io.Writer
+	sinks      []eventSink
 
-	termWidth  int
-	progress   Progress
-	currentRel string
-}
+	termWidth      int
+	isTTY          bool
+	partialBytes   atomic.Int64 // read so far from files still being copied
+	progress       Progress
+	currentRel     string
+	paths          []string          // given up front instead of scanning
+	dstNames       map[string]string // destination names given with the paths, for verify
+	pending        []orderKey        // scanned paths waiting to be sorted by --order
+	ignores        map[string][]ignoreRule
+	placed         []placement
+	verifyWG       sync.WaitGroup
+	diffs          []treeDiff
+	manifest       Manifest
+	bufferSize     int
+	sequentialRead bool
+	timings        *Timings
+	hash           hashAlg
+	began          time.Time
+	usedDests      []string
+	remainingList  string // last remaining-files list written
+	fds            *fdSemaphore
+	limiter        *rateLimiter
 
-func (s *Session) Run() error {
-	paths := make(chan string)
-	errCh := make(chan error, 1)
+	mu            sync.Mutex
+	allPaths      []string
+	scanTotal     Stats // files and bytes scanned so far, from --start-index on
+	scanDirs      []string
+	nestedDests   []string          // relative paths of destinations inside the source, left out of the scan
+	nestedSources map[string]string // destination -> relative path of the source inside it, left out of --delete
+	placeholders  map[string]int    // --two-pass placeholder -> index of the file it stands for
+	emptyDirs     []string          // scanned directories without files, created at the end
+	scanned       chan struct{}
+	scanDone      chan struct{}
+	scanErr       error
 
-	go s.scan(paths, errCh)
+	done        map[int]bool
+	deferred    []copyJob // --pack greedy: files waiting for the next destination
+	deferredErr error
+	deferredGen int
+	conflictAll string              // --on-conflict=prompt answer chosen for all files, guarded by swapMu
+	links       map[inode]placement // first copy of each hard-linked source file
+	inodes      map[string]inode    // scanned source files with hard links, for -H
+	linking     map[inode]string    // hard-linked source files being copied, by inode
+	claimed     map[string]string   // destination name -> source file, for renaming collisions
+	foldCase    bool                // a destination is case-insensitive, so claimed keys are lower case
+	caps        map[string]destCaps // what each destination can hold, by its cleaned path
+	failures    []failure
+	damaged     []damagedFile
+	destGen     int
+	writers     int  // copies in progress to the current destinations
+	swapping    bool // a full destination is being finalized; no new copies start
+	prompting   bool
+	pauseCond   *sync.Cond
+	swapMu      sync.Mutex
+	interrupted atomic.Bool
+	stopCh      chan struct{}
+	stopOnce    sync.Once
+}
 
-	for {
-		select {
+func (s *Session) Run() (err error) {
+	if err := s.openEventSinks(); err != nil {
+		return err
+	}
+	if err := s.openLog(); err != nil {
+		return err
+	}
+	if s.args.Par2 > 0 {
+		if err := checkPar2(); err != nil {
+			return err
+		}
+	}
+	if s.args.Nice != 0 || s.args.Ionice != "none" {
+		if err := setPriority(s.args.Nice, s.args.Ionice); err != nil {
+			return fmt.Errorf("setting priority: %w", err)
+		}
+	}
+	s.applyMediaType()
+	if s.args.Engine == "uring" {
+		if err := probeUring(); err != nil {
+			fmt.Fprintf(s.out, "io_uring isn't available (%v); using the default engine\n", err)
+			s.args.Engine = "default"
+		}
+	}
+	if s.args.DryRunManifest != "" {
+		return s.writeDryRunManifest()
+	}
+	if s.args.RequireSameDevice {
+		if err := s.checkSameDevice(); err != nil {
+			return err
+		}
+	}
+	if err := s.checkNesting(); err != nil {
+		return err
+	}
+	s.warnSameDeviceMove()
+	if s.args.ManifestDiff != "" {
+		m, err := readManifest(s.args.ManifestDiff, s.hash)
+		if err != nil {
+			return err
+		}
+		s.manifest = m
+	}
 
-		case <-s.sigIntChan:
-			return s.exitWithRemaining(paths)
+	go s.scan()
 
-		case rel, more := <-paths:
-			if !more {
-				s.printProgress()
-				fmt.Println()
-				return <-errCh
-			}
+	if s.args.DryRun {
+		return s.dryRun()
+	}
 
-			if err := s.copyWithRetry(rel, paths); err != nil {
-				return err
-			}
+	s.mu.Lock()
+	s.useDest(s.args.Destination)
+	s.useDest(s.args.MirrorTo)
+	s.checkCase(s.args.Destination)
+	s.probeCaps(s.args.Destination)
+	s.checkCase(s.args.MirrorTo)
+	s.probeCaps(s.args.MirrorTo)
+	s.mu.Unlock()
+	defer func() {
+		status := "ok"
+		if err != nil {
+			status = "failed"
+		}
+		s.writeSummary(status, err, len(s.remainingPaths(s.args.StartIndex)))
+	}()
+
+	if err := s.confirmOverwrites(s.args.StartIndex); err != nil {
+		return err
+	}
+	if s.args.TwoPass {
+		if err := s.createPlaceholders(s.args.StartIndex); errors.Is(err, errInterrupted) {
+			return s.exitWithRemaining(s.args.StartIndex)
+		} else if err != nil {
+			return err
 		}
 	}
-}
+	if err := s.copyLoop(s.args.StartIndex); err != nil {
+		return err
+	}
+	s.saveFailures()
+	s.saveDamaged()
+	if s.progress.VerifyFailed > 0 {
+		s.saveRemaining(s.remainingPaths(s.args.StartIndex))
+		return fmt.Errorf("%d files failed verification after copying", s.progress.VerifyFailed)
+	}
+	if s.progress.Failed > 0 {
+		s.saveRemaining(s.remainingPaths(s.args.StartIndex))
+		return fmt.Errorf("%d files could not be copied", s.progress.Failed)
+	}
+	if d := s.progress.Damaged; d.Files > 0 {
+		return fmt.Errorf("%d files were copied with %s unreadable", d.Files, humanBytes(d.Bytes))
+	}
+	if err := s.checkSelected(s.args.StartIndex); err != nil {
+		return err
+	}
+	if err := s.deleteExtraAll(); err != nil {
+		return err
+	}
 
-func (s *Session) copyWithRetry(rel string, paths <-chan string) error {
-	s.currentRel = rel
+	if s.args.VerifyTree {
+		err = s.verifyTree()
+	}
+	s.emit(Event{Type: EventDone, Bytes: s.progress.Global.Bytes, Detail: strconv.FormatInt(s.progress.Global.Files, 10)})
+	return err
+}
 
+func (s *Session) copyWithRetry(job copyJob) error {
+	rel := job.rel
 	src := filepath.Join(s.args.Source, rel)
-	sInfo, err := os.Stat(src)
-	if err != nil {
-		fmt.Println()
-		fmt.Printf("%v\n", err)
+	sInfo, err := s.args.statSource(src)
+	if err != nil && s.skipFailed(rel, err) {
+		return nil
+	} else if err != nil {
+		s.mu.Lock()
+		fmt.Fprintln(s.out)
+		fmt.Fprintf(s.out, "%v\n", err)
+		s.progress.Errors++
+		s.emit(Event{Type: EventError, Path: rel, Detail: err.Error()})
+		s.placed = append(s.placed, placement{rel: rel})
+		s.done[job.index] = true
+		s.mu.Unlock()
 		return nil
 	}
 
 	size := sInfo.Size()
 
-	if s.progress.Local.Files == 0 || time.Since(s.progress.lastPrintTime) >= 320*time.Millisecond {
+	if reason := s.skipReason(rel, src, sInfo); reason != "" {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.progress.Skipped.Files++
+		s.progress.Skipped.Bytes += size
+		s.done[job.index] = true
+		s.emit(Event{Type: EventSkipped, Path: rel, Bytes: size, Detail: reason})
+		return nil
+	}
+
+	s.mu.Lock()
+	s.currentRel = rel
+	s.emit(Event{Type: EventStarted, Path: rel, Bytes: size})
+	if s.progress.Local.Files == 0 || time.Since(s.progress.lastPrintTime) >= progressInterval {
 		s.printProgress()
 	}
+	s.mu.Unlock()
 
+	link := sInfo.Mode()&os.ModeSymlink != 0
+	special := sInfo.Mode()&specialMode != 0
+	name, clash := s.claimDestName(rel, sInfo)
+	s.claimLink(rel)
+	defer s.unclaimLink(rel)
+	var attempt int // --retries used
+	var writing bool
+	endWrite := func() {
+		if writing {
+			s.endWrite()
+			writing = false
+		}
+	}
+	defer endWrite()
 	for {
 		// Check for interrupt
-		if len(s.sigIntChan) > 0 {
-			return s.exitWithRemaining(paths)
+		if s.interrupted.Load() {
+			return errInterrupted
+		}
+
+		s.mu.Lock()
+		dest, mirror, gen := s.args.Destination, s.args.MirrorTo, s.destGen
+		s.mu.Unlock()
+
+		dstRel, action := s.resolveConflict(rel, name, clash, sInfo, []string{dest, mirror})
+		switch action {
+		case conflictSkip:
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			s.progress.Skipped.Files++
+			s.progress.Skipped.Bytes += size
+			s.done[job.index] = true
+			s.emit(Event{Type: EventSkipped, Path: rel, Bytes: size, Detail: "exists"})
+			return nil
+		case conflictError:
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			fmt.Fprintf(s.out, "\r%s: destination already exists\033[K\n", dstRel)
+			s.progress.Errors++
+			s.emit(Event{Type: EventError, Path: rel, Detail: "destination already exists"})
+			s.placed = append(s.placed, placement{rel: rel})
+			s.done[job.index] = true
+			return nil
+		}
+		if !s.beginWrite(gen) {
+			continue // swapped while resolving the conflict
+		}
+		writing = true
+		dsts := []string{filepath.Join(dest, dstRel)}
+		if mirror != "" {
+			dsts = append(dsts, filepath.Join(mirror, dstRel))
+		}
+		var full error
+		if !s.parityFits(dest, size) {
+			full = &destError{0, errParityReserve}
+		} else if mirror != "" && !s.parityFits(mirror, size) {
+			full = &destError{1, errParityReserve}
+		}
+		if full != nil && s.deferJob(job, full) {
+			return nil
+		} else if full != nil && s.chunks(full, sInfo) {
+			endWrite()
+			return s.copyChunks(job, src, dstRel, sInfo)
+		} else if full != nil {
+			endWrite()
+			if err := s.swapDestination(full, gen); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if same := sameFileAs(src, dsts); same != "" {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			fmt.Fprintf(s.out, "\r%s: same file as %s, not copied\033[K\n", rel, same)
+			s.progress.Skipped.Files++
+			s.progress.Skipped.Bytes += size
+			s.done[job.index] = true
+			s.emit(Event{Type: EventSkipped, Path: rel, Bytes: size, Detail: "same file"})
+			return nil
+		}
+
+		if first, ok := s.hardLink(rel, dest, mirror, dsts); ok {
+			removeErr := s.removeSource(src)
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			if removeErr != nil {
+				fmt.Fprintf(s.out, "\r%v\033[K\n", removeErr)
+				s.progress.Errors++
+				s.emit(Event{Type: EventError, Path: rel, Detail: removeErr.Error()})
+			}
+			s.progress.Global.Files++
+			s.progress.Global.Bytes += size
+			// Nothing was written to the disk, so Local is left alone
+			s.progress.Linked.Files++
+			s.progress.Linked.Bytes += size
+			s.placed = append(s.placed, placement{rel: rel, dstRel: dstRel, dest: dest, mirror: mirror, sum: first.sum, written: first.written})
+			s.emit(Event{Type: EventCopied, Path: rel, Bytes: size, Detail: dest})
+			s.done[job.index] = true
+			return nil
+		}
+
+		if !s.fits(dest, dstRel, sInfo) {
+			full = &destError{0, errWontFit}
+		} else if mirror != "" && !s.fits(mirror, dstRel, sInfo) {
+			full = &destError{1, errWontFit}
 		}
+		if full != nil && s.deferJob(job, full) {
+			return nil
+		} else if full != nil && s.chunks(full, sInfo) {
+			endWrite()
+			return s.copyChunks(job, src, dstRel, sInfo)
+		} else if full != nil {
+			endWrite()
+			if err := s.swapDestination(full, gen); err != nil {
+				return err
+			}
+			continue
+		}
+
+		started := time.Now()
+		res, err := s.withFileTimeout(func(watch *stallWatch) (copyResult, error) {
+			if link {
+				return s.copyLink(src, dsts)
+			} else if special {
+				return s.copySpecial(src, dsts)
+			}
+			return s.copyFile(src, dsts, watch)
+		})
+		if errors.Is(err, errInterrupted) {
+			return err
+		} else if err == nil {
+			var removeErr error
+			if len(res.damaged) == 0 { // keep a damaged source for another attempt
+				removeErr = s.removeSource(src)
+			}
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			if removeErr != nil {
+				fmt.Fprintf(s.out, "\r%v\033[K\n", removeErr)
+				s.progress.Errors++
+				s.emit(Event{Type: EventError, Path: rel, Detail: removeErr.Error()})
+			}
+
+			took := time.Since(started)
+			s.timings.record(rel, size, took)
+
+			if res.holes > 0 {
+				s.progress.Sparse.Files++
+				s.progress.Sparse.Holes += int64(res.holes)
+				s.progress.Sparse.Bytes += res.holeBytes
+				fmt.Fprintf(s.out, "\rsparse: %s: %d holes, saved %s\033[K\n", rel, res.holes, humanBytes(res.holeBytes))
+			}
+			if len(res.damaged) > 0 {
+				n := damagedBytes(res.damaged)
+				s.progress.Damaged.Files++
+				s.progress.Damaged.Bytes += n
+				s.progress.Errors++
+				s.damaged = append(s.damaged, damagedFile{rel, res.damaged})
+				fmt.Fprintf(s.out, "\rdamaged: %s: %s in %d ranges unreadable, written as zeros\033[K\n", rel, humanBytes(n), len(res.damaged))
+				s.emit(Event{Type: EventError, Path: rel, Detail: fmt.Sprintf("%d bytes unreadable, written as zeros", n)})
+			}
+			if res.cloned {
+				s.progress.Cloned.Files++
+				s.progress.Cloned.Bytes += size
+			}
+			if len(res.lost) > 0 {
+				s.progress.LostStreams += int64(len(res.lost))
+				fmt.Fprintf(s.out, "\rstreams: %s: not preserved: %s\033[K\n", rel, strings.Join(res.lost, ", "))
+			}
+			if len(res.lostAttrs) > 0 {
+				s.progress.LostXattrs += int64(len(res.lostAttrs))
+				fmt.Fprintf(s.out, "\rxattrs: %s: not preserved: %s\033[K\n", rel, strings.Join(res.lostAttrs, ", "))
+			}
+			if res.lostACL {
+				s.progress.LostACLs++
+				fmt.Fprintf(s.out, "\racls: %s: not preserved\033[K\n", rel)
+			}
 
-		dst := filepath.Join(s.args.Destination, rel)
-		err := s.copyFile(src, dst)
-		if err == nil {
 			s.progress.Global.Files++
 			s.progress.Global.Bytes += size
 			s.progress.Local.Files++
 			s.progress.Local.Bytes += size
+			s.placed = append(s.placed, placement{rel: rel, dstRel: dstRel, dest: dest, mirror: mirror, sum: res.sum, written: res.written})
+			s.rememberLink(rel, s.placed[len(s.placed)-1])
+			s.emit(Event{Type: EventCopied, Path: rel, Bytes: size, Detail: dest, Duration: took})
+			s.done[job.index] = true
+			return nil
+		} else if errors.Is(err, errVerifyFailed) {
+			// Not marked done, so the file stays in the remaining list
+			s.mu.Lock()
+			defer s.mu.Unlock()
 
-			s.currentRel = ""
+			fmt.Fprintln(s.out)
+			fmt.Fprintf(s.out, "%s: %v\n", rel, err)
+			s.progress.Errors++
+			s.progress.VerifyFailed++
+			s.emit(Event{Type: EventMismatch, Path: rel, Detail: err.Error()})
 			return nil
-		} else {
-			fmt.Println()
-			fmt.Printf("%v\n", err)
+		} else if errors.Is(err, errPipeFailed) || errors.Is(err, errLinkFailed) || errors.Is(err, errSpecialFailed) || errors.Is(err, errNoClone) {
+			s.recordFailure(rel, err)
+			return nil
+		}
 
-			newDest, err := s.promptForNewPath()
-			if err != nil {
-				return s.exitWithRemaining(paths)
-			}
-			if s.args.Destination != newDest {
-				s.args.Destination = newDest
+		endWrite()
+		if s.retry(rel, err, &attempt) {
+			continue
+		} else if s.skipFailed(rel, err) {
+			return nil
+		}
+		if err := s.swapDestination(err, gen); err != nil {
+			return err
+		}
+	}
+}
 
-				// Reset local stats for new destination
-				s.progress.Local = Stats{}
-				s.progress.start = time.Now()
-				s.progress.diskNum++
-				s.printProgress()
+// beginWrite counts the caller as copying to the destinations of
+// generation gen until endWrite, so that swapDestination doesn't finalize
+// them underneath it. It reports false if they were swapped out meanwhile.
+func (s *Session) beginWrite(gen int) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for s.swapping && !s.interrupted.Load() {
+		s.pauseCond.Wait()
+	}
+	if gen != s.destGen {
+		return false
+	}
+	s.writers++
+	return true
+}
+
+func (s *Session) endWrite() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.writers--
+	s.pauseCond.Broadcast()
+}
+
+// claimDestName reserves the name rel is written under on the
+// destination, as claimName does.
+func (s *Session) claimDestName(rel string, sInfo os.FileInfo) (string, bool) {
+	suffix := s.args.PipeSuffix
+	if sInfo.Mode()&(os.ModeSymlink|specialMode) != 0 {
+		suffix = "" // recreated, not piped
+	}
+	return s.claimName(rel, s.args.destName(rel)+suffix)
+}
+
+// skipReason says why rel doesn't need copying, or returns "" if it does.
+func (s *Session) skipReason(rel, src string, sInfo os.FileInfo) string {
+	if s.manifest != nil && sInfo.Mode().IsRegular() {
+		s.mu.Lock()
+		dest := s.args.Destination
+		s.mu.Unlock()
+		n := s.fds.acquire(1)
+		same, err := s.manifest.unchanged(rel, src, sInfo, s.toleranceOf(dest).same, s.hash)
+		s.fds.release(n)
+		if err == nil && same {
+			return "unchanged"
+		}
+	}
+	if s.args.SkipExisting {
+		s.mu.Lock()
+		dests := []string{s.args.Destination, s.args.MirrorTo}
+		s.mu.Unlock()
+		for _, dest := range dests {
+			if dest == "" {
+				continue
+			}
+			dInfo, err := s.args.statSource(filepath.Join(dest, s.args.destName(rel)))
+			if err != nil || dInfo.Size() != sInfo.Size() || !s.toleranceOf(dest).same(dInfo.ModTime(), sInfo.ModTime()) {
+				return ""
+			}
+		}
+		return "exists"
+	}
+	if s.args.Update {
+		s.mu.Lock()
+		dests := []string{s.args.Destination, s.args.MirrorTo}
+		s.mu.Unlock()
+		for _, dest := range dests {
+			if dest == "" {
+				continue
+			}
+			dInfo, err := s.args.statSource(filepath.Join(dest, s.args.destName(rel)+s.args.PipeSuffix))
+			if err != nil || s.args.TwoPass && dInfo.Size() == 0 && sInfo.Size() > 0 {
+				continue // missing, or a --two-pass placeholder, which has the source mtime
+			}
+			if !s.toleranceOf(dest).newer(sInfo.ModTime(), dInfo.ModTime()) {
+				return "not newer"
 			}
 		}
 	}
+	if s.args.Checksum {
+		s.mu.Lock()
+		dests := []string{s.args.Destination, s.args.MirrorTo}
+		s.mu.Unlock()
+		for _, dest := range dests {
+			if dest == "" {
+				continue
+			}
+			n := s.fds.acquire(2)
+			reason, err := s.hash.compareFile(src, filepath.Join(dest, s.args.destName(rel)))
+			s.fds.release(n)
+			if err != nil || reason != "" {
+				return ""
+			}
+		}
+		return "identical"
+	}
+	return ""
 }
 
-func (s *Session) copyFile(src, dst string) error {
-	if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
-		return err
+// swapDestination asks for a replacement for whichever destination failed.
+// Only one worker prompts at a time; workers whose copy failed against a
+// destination that has since been replaced just retry.
+func (s *Session) swapDestination(copyErr error, gen int) error {
+	s.swapMu.Lock()
+	defer s.swapMu.Unlock()
+
+	s.mu.Lock()
+	stale := gen != s.destGen
+	if !stale {
+		s.prompting = true
+		fmt.Fprintln(s.out)
+		fmt.Fprintf(s.out, "%v\n", copyErr)
+		s.emit(Event{Type: EventFull, Detail: copyErr.Error()})
+
+		// Let the other workers finish the files they're writing to it first
+		s.swapping = true
+		for s.writers > 0 && !s.interrupted.Load() {
+			s.pauseCond.Wait()
+		}
+	}
+	oldDest, oldMirror := s.args.Destination, s.args.MirrorTo
+	s.mu.Unlock()
+	if stale {
+		return nil
+	}
+
+	defer func() {
+		s.mu.Lock()
+		s.prompting = false
+		s.swapping = false
+		s.destGen++
+		s.pauseCond.Broadcast()
+		s.mu.Unlock()
+	}()
+
+	// A full mirror disk is swapped independently of the primary
+	var de *destError
+	mirrorFull := errors.As(copyErr, &de) && de.dest == 1
+	if mirrorFull {
+		s.removePlaceholders(oldMirror)
+		s.writeSums(oldMirror)
+		s.writeRenames(oldMirror)
+		s.writeParity(oldMirror)
+		s.setDirMetadata(oldMirror)
+		s.syncDest(oldMirror)
+	} else {
+		s.removePlaceholders(oldDest)
+		s.writeSums(oldDest)
+		s.writeRenames(oldDest)
+		s.writeParity(oldDest)
+		s.setDirMetadata(oldDest)
+		s.syncDest(oldDest)
+	}
+	if s.args.VerifyTree && s.args.VerifyPolicy == "swap" {
+		if mirrorFull {
+			s.verifyDisk(oldMirror)
+		} else {
+			s.verifyDisk(oldDest)
+		}
+	}
+
+	if mirrorFull {
+		newMirror, err := s.promptForNewPath("mirror destination", s.args.MirrorTo, s.progress.mirrorDiskNum)
+		if err != nil {
+			return errInterrupted
+		}
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if s.args.MirrorTo != newMirror {
+			s.args.MirrorTo = newMirror
+			s.useDest(newMirror)
+			s.checkCase(newMirror)
+			s.probeCaps(newMirror)
+			s.progress.mirrorDiskNum++
+			s.verifyInBackground(oldMirror)
+			s.emit(Event{Type: EventMirror, Detail: newMirror})
+		}
+		return nil
 	}
 
-	cmd := exec.Command("cp", "--sparse=auto", "-p", src, dst)
-	if out, err := cmd.CombinedOutput(); err != nil {
-		_ = os.Remove(dst)
-		return errors.New(string(bytes.TrimSpace(out)))
+	var newDest string
+	if len(s.args.Next) > 0 {
+		newDest, s.args.Next = s.args.Next[0], s.args.Next[1:]
+		fmt.Fprintf(s.out, "Continuing on %s\n", newDest)
+	} else {
+		var err error
+		newDest, err = s.promptForNewPath("destination", s.args.Destination, s.progress.diskNum)
+		if err != nil {
+			return errInterrupted
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.args.Destination != newDest {
+		s.args.Destination = newDest
+		s.useDest(newDest)
+		s.checkCase(newDest)
+		s.probeCaps(newDest)
+
+		// Reset local stats for new destination
+		s.progress.Local = Stats{}
+		s.progress.start = time.Now()
+		s.progress.pausedFor = 0
+		s.progress.rate.reset()
+		if !s.progress.pausedAt.IsZero() {
+			s.progress.pausedAt = s.progress.start
+		}
+		s.progress.diskNum++
+		s.prompting = false
+		s.verifyInBackground(oldDest)
+		s.emit(Event{Type: EventDest, Detail: newDest})
+		s.printProgress()
 	}
 	return nil
 }
 
 func (s *Session) printProgress() {
-	elapsed := time.Since(s.progress.start).Seconds()
-	var rate float64
-	if elapsed > 0 {
-		rate = float64(s.progress.Local.Bytes) / elapsed
+	if s.prompting || s.args.Porcelain {
+		return
+	}
+	// Don't flood logs when output isn't a terminal
+	if !s.isTTY && time.Since(s.progress.lastPrintTime) < 10*time.Second {
+		return
 	}
 
-	status := fmt.Sprintf("[Global: %d files, %s]%s | %s/s",
-		s.progress.Global.Files,
-		humanBytes(s.progress.Global.Bytes),
-		func() string {
-			if s.progress.Global.Files == s.progress.Local.Files {
-				return ""
-			}
-			return fmt.Sprintf(" [Dest: %d files, %s]", s.progress.Local.Files, humanBytes(s.progress.Local.Bytes))
-		}(),
-		humanBytes(int64(rate)),
-	)
+	partial := s.partialBytes.Load()
+	elapsed := s.progress.activeTime().Seconds()
+	rate, ok := s.progress.rate.rate()
+	if !ok && elapsed > 0 {
+		rate = float64(s.progress.Local.Bytes+partial) / elapsed
+	}
+
+	var status string
+	if !s.progress.pausedAt.IsZero() {
+		status = "PAUSED "
+	}
+
+	scanning := true
+	select {
+	case <-s.scanDone:
+		scanning = false
+	default:
+	}
+	total := s.scanTotal
+	done := Stats{
+		Files: s.progress.Global.Files + s.progress.Skipped.Files,
+		Bytes: s.progress.Global.Bytes + s.progress.Skipped.Bytes + partial,
+	}
+	var fraction float64
+	switch {
+	case total.Bytes > 0:
+		fraction = min(float64(done.Bytes)/float64(total.Bytes), 1)
+	case total.Files > 0:
+		fraction = min(float64(done.Files)/float64(total.Files), 1)
+	}
+	if total.Files > 0 {
+		status += progressBar(fraction, 20) + fmt.Sprintf(" %3.0f%% ", 100*fraction)
+	}
+	status += fmt.Sprintf("%d/%d", done.Files, total.Files)
+	if scanning {
+		status += "+"
+	}
+	status += fmt.Sprintf(" files, %s/%s", humanBytes(done.Bytes), humanBytes(total.Bytes))
+	if scanning {
+		status += "+"
+	}
+	if s.progress.Global.Files != s.progress.Local.Files {
+		status += fmt.Sprintf(" [Dest: %d files, %s]", s.progress.Local.Files, humanBytes(s.progress.Local.Bytes))
+	}
+	status += fmt.Sprintf(" | %s/s", humanBytes(int64(rate)))
+	if !scanning && rate > 0 && done.Bytes < total.Bytes {
+		status += " | ETA " + formatETA(time.Duration(float64(total.Bytes-done.Bytes)/rate*float64(time.Second)))
+	}
+	if s.args.Jobs > 1 {
+		status += fmt.Sprintf(" | %d active", s.progress.active)
+	}
 
 	remainingSpace := s.termWidth - len(status) - 4
 	if remainingSpace > 10 {
 		status = status + " | " + truncateMiddle(s.currentRel, remainingSpace)
 	}
 
-	fmt.Print("\r" + status + "\033[K")
+	if s.isTTY {
+		fmt.Fprint(s.out, "\r"+status+"\033[K")
+	} else {
+		fmt.Fprintln(s.out, status)
+	}
 	s.progress.lastPrintTime = time.Now()
 }
 
+// finishProgress prints the final state of the progress line.
+func (s *Session) finishProgress() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.progress.lastPrintTime = time.Time{}
+	s.printProgress()
+	if s.isTTY {
+		fmt.Fprintln(s.out)
+	}
+}
+
+func progressBar(fraction float64, width int) string {
+	filled := int(fraction * float64(width))
+	return "[" + strings.Repeat("#", filled) + strings.Repeat("-", width-filled) + "]"
+}
+
+func formatETA(d time.Duration) string {
+	switch {
+	case d >= time.Hour:
+		return fmt.Sprintf("%dh%02dm", int(d.Hours()), int(d.Minutes())%60)
+	case d >= time.Minute:
+		return fmt.Sprintf("%dm%02ds", int(d.Minutes()), int(d.Seconds())%60)
+	default:
+		return fmt.Sprintf("%ds", int(d.Seconds()))
+	}
+}
+
+// tickProgress redraws the progress line between file completions so it
+// keeps moving while large files are copied.
+func (s *Session) tickProgress(stop <-chan struct{}) {
+	ticker := time.NewTicker(progressInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case now := <-ticker.C:
+			s.mu.Lock()
+			if s.progress.pausedAt.IsZero() {
+				s.progress.rate.add(now, s.progress.Global.Bytes+s.partialBytes.Load())
+			}
+			if time.Since(s.progress.lastPrintTime) >= progressInterval {
+				s.printProgress()
+			}
+			s.mu.Unlock()
+		case <-stop:
+			return
+		}
+	}
+}
+
 func humanBytes(n int64) string {
 	const unit = 1024
 	if n < unit {
@@ -239,10 +1366,15 @@ func truncateMiddle(s string, max int) string {
 	return s[:half] + "…" + s[len(s)-half:]
 }
 
-func (s *Session) promptForNewPath() (string, error) {
-	fmt.Println()
-	fmt.Printf("Enter new destination path (ie. \"insert disk %d\"):\n", s.progress.diskNum)
+func (s *Session) promptForNewPath(label, current string, diskNum int) (string, error) {
+	fmt.Fprintln(s.out)
+	fmt.Fprintf(s.out, "Enter new %s path (ie. \"insert disk %d\"):\n", label, diskNum)
+	return readDirectory(current)
+}
 
+// readDirectory reads a path from the terminal, completing directory
+// names, with current as the editable default.
+func readDirectory(current string) (string, error) {
 	rl, err := readline.NewEx(&readline.Config{
 		Prompt: "?> ",
 		AutoComplete: readline.NewPrefixCompleter(
@@ -267,59 +1399,60 @@ func (s *Session) promptForNewPath() (string, error) {
 	}
 	defer rl.Close()
 
-	input, err := rl.ReadLineWithDefault(s.args.Destination)
+	input, err := rl.ReadLineWithDefault(current)
 	return strings.TrimSpace(input), err
 }
 
-func (s *Session) exitWithRemaining(paths <-chan string) error {
+// exitWithRemaining saves every path from startIndex onwards that wasn't
+// completed, including interrupted in-progress files, once the scan has
+// finished.
+func (s *Session) exitWithRemaining(startIndex int) error {
 	if s.args.ResumeList == nil {
-		fmt.Println("\nInterrupt received. Finishing source directory tree scan...")
+		fmt.Fprintln(s.out, "\nInterrupt received. Finishing source directory tree scan...")
 	}
+	<-s.scanDone
 
-	var remaining []string
-	if s.currentRel != "" {
-		remaining = append(remaining, s.currentRel)
-	}
-	for rel := range paths {
-		remaining = append(remaining, rel)
+	s.saveFailures()
+	s.saveDamaged()
+	remaining := s.remainingPaths(startIndex)
+	name := s.saveRemaining(remaining)
+	if name != "" {
+		s.emit(Event{Type: EventRemaining, Bytes: int64(len(remaining)), Detail: name})
 	}
-
-	s.saveRemaining(remaining)
+	s.writeSummary("interrupted", nil, len(remaining))
 	os.Exit(130)
 	return nil
 }
 
-func (s *Session) saveRemaining(remaining []string) {
-	if len(remaining) == 0 {
-		return
+func (s *Session) saveRemaining(remaining []string) string {
+	name := s.savePaths(".remainingfiles", "Remaining", remaining)
+	if name != "" {
+		s.remainingList = name
+	}
+	return name
+}
+
+// savePaths writes paths to a list file next to the working directory and
+// returns its name, or "" if there was nothing to save.
+func (s *Session) savePaths(suffix, label string, paths []string) string {
+	if len(paths) == 0 {
+		return ""
 	}
 
-	name := filepath.Base(s.args.Source) + ".remainingfiles"
+	name := filepath.Base(s.args.Source) + suffix
 	f, err := os.Create(name)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "failed to write remaining file: %v\n", err)
-		return
+		fmt.Fprintf(os.Stderr, "failed to write %s file: %v\n", strings.ToLower(label), err)
+		return ""
 	}
 	defer f.Close()
 
-	for _, line := range remaining {
+	for _, line := range paths {
 		fmt.Fprintln(f, line)
 	}
-	fmt.Println()
-	fmt.Printf("Remaining paths saved to: %s\n", name)
-}
-
-func (s *Session) watchResize() {
-	// Initialize width
-	s.updateWidth()
-
-	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, syscall.SIGWINCH)
-	go func() {
-		for range sigChan {
-			s.updateWidth()
-		}
-	}()
+	fmt.Fprintln(s.out)
+	fmt.Fprintf(s.out, "%s paths saved to: %s\n", label, name)
+	return name
 }
 
 func (s *Session) updateWidth() {
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/alecthomas/kong"
+)
+
+// parseFlag decodes value as a flag of type T, the way the command line
+// is decoded.
+func parseFlag[T any](t *testing.T, value string) (T, error) {
+	t.Helper()
+	var cli struct {
+		Flag T
+	}
+	parser, err := kong.New(&cli)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = parser.Parse([]string{"--flag", value})
+	return cli.Flag, err
+}
+
+// run runs a splitcopy command line.
+func run(t *testing.T, args ...string) error {
+	t.Helper()
+	var cli CLI
+	parser, err := kong.New(&cli)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, err := parser.Parse(args)
+	if err != nil {
+		return err
+	}
+	return ctx.Run()
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"bufio"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// ManifestEntry describes one file of a catalogued tree. Manifests are
+// either JSON lines of this struct or plain sha256sum (or b3sum) output.
+// Metadata fields are optional and only used by restore-attrs.
+type ManifestEntry struct {
+	Path   string `json:"path"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256,omitempty"`
+	XXH3   string `json:"xxh3,omitempty"`
+	BLAKE3 string `json:"blake3,omitempty"`
+
+	Mode   string            `json:"mode,omitempty"` // octal, e.g. "0644"
+	UID    *int              `json:"uid,omitempty"`
+	GID    *int              `json:"gid,omitempty"`
+	Mtime  *time.Time        `json:"mtime,omitempty"`
+	Xattrs map[string][]byte `json:"xattrs,omitempty"` // values are base64 in JSON
+}
+
+type Manifest map[string]ManifestEntry
+
+var sumLine = regexp.MustCompile(`^([0-9a-fA-F]{16}|[0-9a-fA-F]{64}) [ *](.+)$`)
+
+// hash points at the entry's hex digest field for alg.
+func (e *ManifestEntry) hash(alg hashAlg) *string {
+	switch alg.name {
+	case "xxh3":
+		return &e.XXH3
+	case "blake3":
+		return &e.BLAKE3
+	}
+	return &e.SHA256
+}
+
+// readManifest reads a JSON lines manifest or checksum tool output, whose
+// digests are taken to be of type alg.
+func readManifest(name string, alg hashAlg) (Manifest, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	m := make(Manifest)
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 1<<20)
+	for n := 1; scanner.Scan(); n++ {
+		line := scanner.Text()
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		entry := ManifestEntry{Size: -1}
+		if strings.HasPrefix(line, "{") {
+			if err := json.Unmarshal([]byte(line), &entry); err != nil {
+				return nil, fmt.Errorf("%s:%d: %w", name, n, err)
+			}
+		} else if sm := sumLine.FindStringSubmatch(line); sm != nil {
+			*entry.hash(alg), entry.Path = strings.ToLower(sm[1]), sm[2]
+		} else {
+			return nil, fmt.Errorf("%s:%d: unrecognized manifest line", name, n)
+		}
+
+		entry.Path = filepath.Clean(entry.Path)
+		m[entry.Path] = entry
+	}
+	return m, scanner.Err()
+}
+
+// unchanged reports whether the source file matches its manifest entry.
+// Sizes are compared first so that only same-sized files are hashed, with
+// alg if the entry has that digest or else whichever one it has. Entries
+// without a hash fall back to comparing mtimes when one was recorded.
+func (m Manifest) unchanged(rel, src string, info os.FileInfo, sameMtime func(a, b time.Time) bool, alg hashAlg) (bool, error) {
+	entry, ok := m[filepath.Clean(rel)]
+	if !ok {
+		return false, nil
+	}
+	if entry.Size >= 0 && entry.Size != info.Size() {
+		return false, nil
+	}
+
+	want := *entry.hash(alg)
+	if want == "" {
+		for _, name := range []string{"sha256", "blake3", "xxh3"} {
+			if h := *entry.hash(hashAlgs[name]); h != "" {
+				alg, want = hashAlgs[name], h
+				break
+			}
+		}
+	}
+	if want == "" {
+		if entry.Mtime != nil && !sameMtime(*entry.Mtime, info.ModTime()) {
+			return false, nil
+		}
+		return entry.Size == info.Size(), nil
+	}
+
+	sum, err := alg.file(src)
+	if err != nil {
+		return false, err
+	}
+	return hex.EncodeToString(sum) == strings.ToLower(want), nil
+}
+
+func newManifestEntry(rel string, info os.FileInfo) ManifestEntry {
+	e := ManifestEntry{
+		Path: filepath.ToSlash(rel),
+		Size: info.Size(),
+		Mode: formatOctalMode(info.Mode()),
+	}
+	if uid, gid, ok := fileOwner(info); ok {
+		e.UID, e.GID = &uid, &gid
+	}
+	mtime := info.ModTime().UTC()
+	e.Mtime = &mtime
+	return e
+}
+
+// writeDryRunManifest catalogues the selected source files instead of
+// copying them. Hashing is optional because it reads every source byte.
+func (s *Session) writeDryRunManifest() error {
+	f, err := os.Create(s.args.DryRunManifest)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	err = s.catalogue(json.NewEncoder(w))
+	if err == nil {
+		err = w.Flush()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(s.out, "Manifest of %d files (%s) saved to: %s\n", s.progress.Global.Files, humanBytes(s.progress.Global.Bytes), s.args.DryRunManifest)
+	return nil
+}
+
+// catalogue encodes a manifest entry for each selected source file.
+func (s *Session) catalogue(enc *json.Encoder) error {
+	go s.scan()
+	for i := s.args.StartIndex; ; i++ {
+		select {
+		case <-s.sigIntChan:
+			return &exitError{130, errInterrupted}
+		default:
+		}
+
+		rel, more, err := s.waitPath(i, nil)
+		if err != nil {
+			return err
+		} else if !more {
+			break
+		}
+
+		src := filepath.Join(s.args.Source, rel)
+		info, err := s.args.statSource(src)
+		if err != nil {
+			fmt.Fprintf(s.out, "%v\n", err)
+			continue
+		}
+		e := newManifestEntry(rel, info)
+		if s.args.keepXattrs() && info.Mode()&os.ModeSymlink == 0 {
+			if e.Xattrs, err = readXattrs(src); err != nil {
+				fmt.Fprintf(s.out, "%s: %v\n", src, err)
+			}
+		}
+		if s.args.DryRunHash && info.Mode().IsRegular() {
+			sum, err := s.hash.file(src)
+			if err != nil {
+				fmt.Fprintf(s.out, "%v\n", err)
+				continue
+			}
+			*e.hash(s.hash) = hex.EncodeToString(sum)
+		}
+		if err := enc.Encode(e); err != nil {
+			return err
+		}
+
+		s.progress.Global.Files++
+		s.progress.Global.Bytes += info.Size()
+		s.progress.Local = s.progress.Global
+		s.currentRel = rel
+		if time.Since(s.progress.lastPrintTime) >= progressInterval {
+			s.mu.Lock()
+			s.printProgress()
+			s.mu.Unlock()
+		}
+	}
+
+	s.finishProgress()
+	return s.checkSelected(s.args.StartIndex)
+}
@@ -0,0 +1,53 @@
+package main
+
+import "fmt"
+
+// mediaPreset holds the performance defaults for one kind of destination.
+type mediaPreset struct {
+	jobs       int
+	bufferSize int
+	sequential bool // ask the kernel for aggressive readahead on the source
+}
+
+var mediaPresets = map[string]mediaPreset{
+	// A single stream with large buffers keeps a spinning disk from seeking
+	// between files.
+	"hdd": {jobs: 1, bufferSize: 8 << 20, sequential: true},
+	"ssd": {jobs: 4, bufferSize: 1 << 20},
+	// NVMe needs many requests in flight to reach its rated throughput.
+	"nvme": {jobs: 16, bufferSize: 1 << 20},
+	// Several files in flight hide per-file round trips to the server.
+	"network": {jobs: 8, bufferSize: 4 << 20, sequential: true},
+}
+
+// applyMediaType fills in defaults from --media-type. Flags given
+// explicitly on the command line take precedence.
+func (s *Session) applyMediaType() {
+	media := s.args.MediaType
+	if media == "auto" {
+		media = detectMediaType(s.args.Destination)
+		if media == "" {
+			fmt.Fprintln(s.out, "Could not detect the destination media type; using default settings")
+		} else {
+			fmt.Fprintf(s.out, "Detected destination media type: %s\n", media)
+		}
+	}
+
+	if p, ok := mediaPresets[media]; ok {
+		if s.args.Jobs == 0 {
+			s.args.Jobs = p.jobs
+		}
+		s.bufferSize = p.bufferSize
+		s.sequentialRead = p.sequential
+	}
+	if s.args.BufferSize > 0 {
+		s.bufferSize = int(s.args.BufferSize)
+	}
+}
+
+func (s *Session) copyBuffer() []byte {
+	if s.bufferSize == 0 {
+		return nil
+	}
+	return make([]byte, s.bufferSize)
+}
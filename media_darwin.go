@@ -0,0 +1,41 @@
+package main
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// detectMediaType only recognizes network filesystems on macOS; local
+// disks are left to the default settings.
+func detectMediaType(path string) string {
+	dir, _, err := existingParent(path)
+	if err != nil {
+		return ""
+	}
+	var sfs unix.Statfs_t
+	if err := unix.Statfs(dir, &sfs); err != nil {
+		return ""
+	}
+	switch unix.ByteSliceToString(sfs.Fstypename[:]) {
+	case "nfs", "smbfs", "afpfs", "webdav":
+		return "network"
+	}
+	return ""
+}
+
+// adviseSequential is a no-op: readahead is already on by default for
+// regular files on macOS.
+func adviseSequential(f *os.File) {}
+
+// dropCache turns off caching for f. Unlike Linux, pages that are already
+// cached may still be served.
+func dropCache(f *os.File) {
+	_, _ = unix.FcntlInt(f.Fd(), unix.F_NOCACHE, 1)
+}
+
+// dropPages turns off caching for f, which stops it from filling the
+// cache any further.
+func dropPages(f *os.File, wait bool) {
+	dropCache(f)
+}
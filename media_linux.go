@@ -0,0 +1,84 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+const cifsMagicNumber = 0xff534d42
+
+// detectMediaType classifies the filesystem holding path from its type and
+// the /sys/block queue of the underlying device. It returns "" if unsure,
+// e.g. for device-mapper, RAID, or loop devices.
+func detectMediaType(path string) string {
+	dir, _, err := existingParent(path)
+	if err != nil {
+		return ""
+	}
+
+	var sfs unix.Statfs_t
+	if err := unix.Statfs(dir, &sfs); err != nil {
+		return ""
+	}
+	switch uint32(sfs.Type) {
+	case unix.NFS_SUPER_MAGIC, unix.SMB_SUPER_MAGIC, unix.SMB2_SUPER_MAGIC, cifsMagicNumber,
+		unix.V9FS_MAGIC, unix.AFS_SUPER_MAGIC, unix.CEPH_SUPER_MAGIC, unix.CODA_SUPER_MAGIC:
+		return "network"
+	}
+
+	var st unix.Stat_t
+	if err := unix.Stat(dir, &st); err != nil {
+		return ""
+	}
+	dev, err := filepath.EvalSymlinks("/sys/dev/block/" + strconv.FormatUint(uint64(unix.Major(st.Dev)), 10) + ":" + strconv.FormatUint(uint64(unix.Minor(st.Dev)), 10))
+	if err != nil {
+		return ""
+	}
+	// Partitions don't have a queue of their own
+	if _, err := os.Stat(filepath.Join(dev, "queue")); err != nil {
+		dev = filepath.Dir(dev)
+	}
+
+	rotational, err := os.ReadFile(filepath.Join(dev, "queue", "rotational"))
+	if err != nil {
+		return ""
+	}
+	rot, err := strconv.Atoi(strings.TrimSpace(string(rotational)))
+	if err != nil {
+		return ""
+	}
+	switch name := filepath.Base(dev); {
+	case rot == 1:
+		return "hdd"
+	case strings.HasPrefix(name, "nvme"):
+		return "nvme"
+	case strings.HasPrefix(name, "sd"), strings.HasPrefix(name, "mmcblk"):
+		return "ssd"
+	}
+	return ""
+}
+
+func adviseSequential(f *os.File) {
+	_ = unix.Fadvise(int(f.Fd()), 0, 0, unix.FADV_SEQUENTIAL)
+}
+
+// dropCache evicts f from the page cache so the next read comes from the
+// device.
+func dropCache(f *os.File) {
+	_ = unix.Fadvise(int(f.Fd()), 0, 0, unix.FADV_DONTNEED)
+}
+
+// dropPages starts writing back f's dirty pages, waiting for them if wait
+// is set, and evicts the clean ones from the page cache.
+func dropPages(f *os.File, wait bool) {
+	flags := unix.SYNC_FILE_RANGE_WRITE
+	if wait {
+		flags |= unix.SYNC_FILE_RANGE_WAIT_BEFORE | unix.SYNC_FILE_RANGE_WAIT_AFTER
+	}
+	_ = unix.SyncFileRange(int(f.Fd()), 0, 0, flags)
+	dropCache(f)
+}
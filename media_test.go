@@ -0,0 +1,165 @@
+package main
+
+import (
+	"crypto/rand"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+)
+
+// The --media-type presets are measured with these benchmarks. Run them with the
+// source and destination on the kind of disk being tuned for, e.g.
+//
+//	SPLITCOPY_BENCH_SRC=/mnt/nvme SPLITCOPY_BENCH_DST=/mnt/usb-hdd \
+//		go test -run '^$' -bench Media -benchtime 3x
+//
+// Each file is synced before it counts as copied, so the page cache
+// doesn't hide the destination's speed, and the source is dropped from
+// the cache before it's read.
+
+const (
+	benchFiles    = 32
+	benchFileSize = 8 << 20
+)
+
+// benchDir returns a fresh directory under $env, or under the test's temp
+// directory if that isn't set.
+func benchDir(b *testing.B, env string) string {
+	root := os.Getenv(env)
+	if root == "" {
+		return b.TempDir()
+	}
+	dir, err := os.MkdirTemp(root, "splitcopy-bench-")
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.Cleanup(func() { os.RemoveAll(dir) })
+	return dir
+}
+
+// benchSource writes n files of size random bytes and returns their paths.
+func benchSource(b *testing.B, n int, size int64) []string {
+	dir := benchDir(b, "SPLITCOPY_BENCH_SRC")
+	paths := make([]string, n)
+	for i := range paths {
+		paths[i] = filepath.Join(dir, fmt.Sprintf("f%03d", i))
+		f, err := os.Create(paths[i])
+		if err != nil {
+			b.Fatal(err)
+		}
+		if _, err := io.CopyN(f, rand.Reader, size); err != nil {
+			b.Fatal(err)
+		}
+		if err := f.Close(); err != nil {
+			b.Fatal(err)
+		}
+	}
+	return paths
+}
+
+// benchCopy copies src into dir the way copyFile does without extras:
+// through copyPipelined with bufSize buffers, then fsync.
+func benchCopy(src, dir string, bufSize int, sequential bool) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	dropCache(in)
+	if sequential {
+		adviseSequential(in)
+	}
+	out, err := os.Create(filepath.Join(dir, filepath.Base(src)))
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	if _, err := copyPipelined(out, in, make([]byte, bufSize)); err != nil {
+		return err
+	}
+	return out.Sync()
+}
+
+// benchCopyAll copies paths into dir with p.jobs workers.
+func benchCopyAll(b *testing.B, paths []string, dir string, p mediaPreset) {
+	work := make(chan string)
+	errs := make(chan error, len(paths))
+	var wg sync.WaitGroup
+	for range p.jobs {
+		wg.Go(func() {
+			for src := range work {
+				errs <- benchCopy(src, dir, p.bufferSize, p.sequential)
+			}
+		})
+	}
+	for _, src := range paths {
+		work <- src
+	}
+	close(work)
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// benchPreset copies paths with p once per iteration, into a new
+// directory each time, which is removed again off the clock.
+func benchPreset(b *testing.B, paths []string, size int64, p mediaPreset) {
+	b.SetBytes(size)
+	for b.Loop() {
+		dir := benchDir(b, "SPLITCOPY_BENCH_DST")
+		benchCopyAll(b, paths, dir, p)
+		b.StopTimer()
+		os.RemoveAll(dir)
+		b.StartTimer()
+	}
+}
+
+// BenchmarkMediaPresets copies the same files with each preset and with
+// the defaults (one job, 128 KiB buffers). A preset should beat the
+// defaults, and the others, on its own kind of disk.
+func BenchmarkMediaPresets(b *testing.B) {
+	paths := benchSource(b, benchFiles, benchFileSize)
+	presets := map[string]mediaPreset{"default": {jobs: 1, bufferSize: defaultBufferSize}}
+	for name, p := range mediaPresets {
+		presets[name] = p
+	}
+	for _, name := range slices.Sorted(maps.Keys(presets)) {
+		b.Run(name, func(b *testing.B) {
+			benchPreset(b, paths, benchFiles*benchFileSize, presets[name])
+		})
+	}
+}
+
+// BenchmarkMediaJobs varies only the number of files in flight, which is
+// what sets the hdd preset (seeks between files) apart from nvme (queue
+// depth) and network (round trips).
+func BenchmarkMediaJobs(b *testing.B) {
+	paths := benchSource(b, benchFiles, benchFileSize)
+	for _, jobs := range []int{1, 2, 4, 8, 16} {
+		b.Run(fmt.Sprintf("jobs=%d", jobs), func(b *testing.B) {
+			benchPreset(b, paths, benchFiles*benchFileSize, mediaPreset{jobs: jobs, bufferSize: 1 << 20})
+		})
+	}
+}
+
+// BenchmarkMediaBufferSize varies only the buffer size for one large file,
+// with and without sequential readahead on the source.
+func BenchmarkMediaBufferSize(b *testing.B) {
+	paths := benchSource(b, 1, benchFiles*benchFileSize)
+	for _, size := range []int{defaultBufferSize, 1 << 20, 4 << 20, 8 << 20} {
+		for _, sequential := range []bool{false, true} {
+			b.Run(fmt.Sprintf("buffer=%dKiB/sequential=%v", size>>10, sequential), func(b *testing.B) {
+				benchPreset(b, paths, benchFiles*benchFileSize, mediaPreset{jobs: 1, bufferSize: size, sequential: sequential})
+			})
+		}
+	}
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"os"
+
+	"golang.org/x/sys/windows"
+)
+
+// detectMediaType only recognizes network drives and shares on Windows;
+// local disks are left to the default settings.
+func detectMediaType(path string) string {
+	dir, _, err := existingParent(path)
+	if err != nil {
+		return ""
+	}
+	if windows.GetDriveType(volumeRoot(dir)) == windows.DRIVE_REMOTE {
+		return "network"
+	}
+	return ""
+}
+
+// adviseSequential is a no-op: Windows detects sequential reads and reads
+// ahead on its own.
+func adviseSequential(f *os.File) {}
+
+// dropCache is a no-op: Windows can't drop one file from its cache.
+func dropCache(f *os.File) {}
+
+func dropPages(f *os.File, wait bool) {}
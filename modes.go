@@ -0,0 +1,138 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/alecthomas/kong"
+)
+
+// ChmodSpec overrides destination permissions using rsync-style syntax:
+// "D755,F644" sets directories and files separately and a bare "644"
+// applies to both.
+type ChmodSpec struct {
+	Dir, File       fs.FileMode
+	HasDir, HasFile bool
+}
+
+func (c *ChmodSpec) Decode(ctx *kong.DecodeContext) error {
+	var value string
+	if err := ctx.Scan.PopValueInto("mode", &value); err != nil {
+		return err
+	}
+
+	for _, part := range strings.Split(value, ",") {
+		part = strings.TrimSpace(part)
+		target := "DF"
+		if part != "" && (part[0] == 'D' || part[0] == 'F') {
+			target, part = part[:1], part[1:]
+		}
+		mode, err := parseOctalMode(part)
+		if err != nil {
+			return err
+		}
+		if strings.Contains(target, "D") {
+			c.Dir, c.HasDir = mode, true
+		}
+		if strings.Contains(target, "F") {
+			c.File, c.HasFile = mode, true
+		}
+	}
+	return nil
+}
+
+// Umask clears permission bits from preserved modes.
+type Umask fs.FileMode
+
+func (u *Umask) Decode(ctx *kong.DecodeContext) error {
+	var value string
+	if err := ctx.Scan.PopValueInto("mask", &value); err != nil {
+		return err
+	}
+	mask, err := parseOctalMode(value)
+	if err != nil {
+		return err
+	}
+	*u = Umask(mask)
+	return nil
+}
+
+func parseOctalMode(s string) (fs.FileMode, error) {
+	n, err := strconv.ParseUint(s, 8, 32)
+	if err != nil || n > 0o7777 {
+		return 0, fmt.Errorf("invalid octal mode %q", s)
+	}
+
+	mode := fs.FileMode(n & 0o777)
+	if n&0o4000 != 0 {
+		mode |= fs.ModeSetuid
+	}
+	if n&0o2000 != 0 {
+		mode |= fs.ModeSetgid
+	}
+	if n&0o1000 != 0 {
+		mode |= fs.ModeSticky
+	}
+	return mode, nil
+}
+
+// formatOctalMode is the inverse of parseOctalMode.
+func formatOctalMode(mode fs.FileMode) string {
+	n := uint32(mode.Perm())
+	if mode&fs.ModeSetuid != 0 {
+		n |= 0o4000
+	}
+	if mode&fs.ModeSetgid != 0 {
+		n |= 0o2000
+	}
+	if mode&fs.ModeSticky != 0 {
+		n |= 0o1000
+	}
+	return fmt.Sprintf("%04o", n)
+}
+
+const permBits = fs.ModePerm | fs.ModeSetuid | fs.ModeSetgid | fs.ModeSticky
+
+func (s *Session) fileMode(src fs.FileMode) fs.FileMode {
+	if s.args.Chmod.HasFile {
+		return s.args.Chmod.File
+	}
+	return src & permBits &^ fs.FileMode(s.args.Umask)
+}
+
+func (s *Session) dirMode() fs.FileMode {
+	if s.args.Chmod.HasDir {
+		return s.args.Chmod.Dir
+	}
+	return 0o755 &^ fs.FileMode(s.args.Umask)
+}
+
+// mkdirAll creates dir and any missing parents. Directories are chmodded
+// explicitly when a mode was requested since Mkdir is subject to the
+// process umask.
+func (s *Session) mkdirAll(dir string) error {
+	if fi, err := os.Stat(dir); err == nil && fi.IsDir() {
+		return nil
+	}
+	if parent := filepath.Dir(dir); parent != dir {
+		if err := s.mkdirAll(parent); err != nil {
+			return err
+		}
+	}
+
+	mode := s.dirMode()
+	if err := os.Mkdir(dir, mode); err != nil {
+		if os.IsExist(err) {
+			return nil
+		}
+		return err
+	}
+	if s.args.Chmod.HasDir || s.args.Umask != 0 {
+		return os.Chmod(dir, mode)
+	}
+	return nil
+}
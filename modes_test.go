@@ -0,0 +1,32 @@
+package main
+
+import (
+	"io/fs"
+	"testing"
+)
+
+func TestChmodSpec(t *testing.T) {
+	tests := []struct {
+		in   string
+		want ChmodSpec
+	}{
+		{"644", ChmodSpec{Dir: 0o644, File: 0o644, HasDir: true, HasFile: true}},
+		{"D755,F644", ChmodSpec{Dir: 0o755, File: 0o644, HasDir: true, HasFile: true}},
+		{"F600", ChmodSpec{File: 0o600, HasFile: true}},
+		{"D2775", ChmodSpec{Dir: 0o775 | fs.ModeSetgid, HasDir: true}},
+		{"D1777, F4755", ChmodSpec{Dir: 0o777 | fs.ModeSticky, File: 0o755 | fs.ModeSetuid, HasDir: true, HasFile: true}},
+	}
+	for _, tt := range tests {
+		if got, err := parseFlag[ChmodSpec](t, tt.in); err != nil {
+			t.Errorf("--chmod %s: %v", tt.in, err)
+		} else if got != tt.want {
+			t.Errorf("--chmod %s = %+v, want %+v", tt.in, got, tt.want)
+		}
+	}
+
+	for _, in := range []string{"", "rwx", "D", "888", "F10000", "D755,X644"} {
+		if got, err := parseFlag[ChmodSpec](t, in); err == nil {
+			t.Errorf("--chmod %q = %+v, want an error", in, got)
+		}
+	}
+}
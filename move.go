@@ -0,0 +1,35 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// removeSource deletes src, or moves it to the trash with --trash, after it
+// has been copied when --remove-source-files is set.
+func (s *Session) removeSource(src string) error {
+	if !s.args.RemoveSourceFiles {
+		return nil
+	}
+	remove := os.Remove
+	if s.args.Trash {
+		remove = moveToTrash
+	}
+	if err := remove(src); err != nil {
+		return fmt.Errorf("copied but not removed from source: %w", err)
+	}
+	return nil
+}
+
+// warnSameDeviceMove points out that --remove-source-files copies every
+// byte even when a rename would do.
+func (s *Session) warnSameDeviceMove() {
+	if !s.args.RemoveSourceFiles {
+		return
+	}
+	src, err1 := deviceOf(s.args.Source)
+	dst, err2 := deviceOf(s.args.Destination)
+	if err1 == nil && err2 == nil && src == dst {
+		fmt.Fprintf(s.out, "Warning: %s and %s are on the same filesystem, where mv would rename the files instead of copying them\n", s.args.Source, s.args.Destination)
+	}
+}
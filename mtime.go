@@ -0,0 +1,79 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Timestamp granularities of common filesystems, coarsest first: FAT, whole
+// seconds (HFS+, ext3), exFAT, microseconds (some network filesystems), and
+// NTFS. Anything finer is treated as nanosecond precision.
+var mtimeResolutions = []time.Duration{2 * time.Second, time.Second, 10 * time.Millisecond, time.Microsecond, 100 * time.Nanosecond}
+
+// mtimeResolution sets an mtime that isn't a multiple of any of the known
+// granularities on the file name and reports what survives.
+func mtimeResolution(name string) (time.Duration, error) {
+	want := time.Unix(1_000_000_001, 123_456_789)
+	if err := os.Chtimes(name, want, want); err != nil {
+		return 0, err
+	}
+	info, err := os.Stat(name)
+	if err != nil {
+		return 0, err
+	}
+
+	got := info.ModTime().UnixNano()
+	for _, r := range mtimeResolutions {
+		if got%int64(r) == 0 {
+			return r, nil
+		}
+	}
+	return time.Nanosecond, nil
+}
+
+// mtimeTolerance is how far apart two mtimes may be and still count as
+// equal on a destination.
+type mtimeTolerance struct {
+	slack time.Duration
+	local bool // FAT, which keeps mtimes in local time
+}
+
+// toleranceOf returns the mtime tolerance for files on dest. Without
+// --strict-mtime or --mtime-tolerance it is the timestamp resolution
+// probed when dest was first used, or 1s if it couldn't be probed. FAT
+// also stores local time rather than UTC, so its mtimes move by an hour
+// whenever daylight saving time starts or ends.
+func (s *Session) toleranceOf(dest string) mtimeTolerance {
+	switch {
+	case s.args.StrictMtime:
+		return mtimeTolerance{}
+	case s.args.MtimeTolerance > 0:
+		return mtimeTolerance{slack: s.args.MtimeTolerance}
+	}
+	s.mu.Lock()
+	r := s.caps[filepath.Clean(dest)].mtime
+	s.mu.Unlock()
+	if r == 0 {
+		return mtimeTolerance{slack: time.Second}
+	}
+	return mtimeTolerance{slack: r, local: r == mtimeResolutions[0]}
+}
+
+// same reports whether a and b are within the tolerance. On FAT, mtimes
+// exactly an hour apart, give or take the tolerance, match as well.
+func (t mtimeTolerance) same(a, b time.Time) bool {
+	return a.Sub(b).Abs() <= t.slack || t.shifted(a, b)
+}
+
+// newer reports whether a is newer than b by more than the tolerance,
+// other than by the hour FAT's mtimes move.
+func (t mtimeTolerance) newer(a, b time.Time) bool {
+	return a.After(b.Add(t.slack)) && !t.shifted(a, b)
+}
+
+// shifted reports whether a and b are an hour apart, give or take the
+// tolerance, on FAT.
+func (t mtimeTolerance) shifted(a, b time.Time) bool {
+	return t.local && (a.Sub(b).Abs()-time.Hour).Abs() <= t.slack
+}
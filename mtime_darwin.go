@@ -0,0 +1,32 @@
+package main
+
+import (
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// fsMtimeResolution guesses the timestamp resolution of the filesystem
+// holding path from its type, for when it can't be probed. It returns 0
+// if the type can't be read.
+func fsMtimeResolution(path string) time.Duration {
+	dir, _, err := existingParent(path)
+	if err != nil {
+		return 0
+	}
+	var sfs unix.Statfs_t
+	if err := unix.Statfs(dir, &sfs); err != nil {
+		return 0
+	}
+	switch unix.ByteSliceToString(sfs.Fstypename[:]) {
+	case "msdos":
+		return 2 * time.Second
+	case "hfs":
+		return time.Second
+	case "exfat":
+		return 10 * time.Millisecond
+	case "ntfs", "smbfs":
+		return 100 * time.Nanosecond
+	}
+	return time.Nanosecond
+}
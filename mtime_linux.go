@@ -0,0 +1,37 @@
+package main
+
+import (
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+const (
+	ntfsMagicNumber    = 0x5346544e // the kernel's ntfs3 driver
+	hfsplusMagicNumber = 0x482b
+)
+
+// fsMtimeResolution guesses the timestamp resolution of the filesystem
+// holding path from its type, for when it can't be probed. It returns 0
+// if the type can't be read.
+func fsMtimeResolution(path string) time.Duration {
+	dir, _, err := existingParent(path)
+	if err != nil {
+		return 0
+	}
+	var sfs unix.Statfs_t
+	if err := unix.Statfs(dir, &sfs); err != nil {
+		return 0
+	}
+	switch uint32(sfs.Type) {
+	case unix.MSDOS_SUPER_MAGIC:
+		return 2 * time.Second
+	case hfsplusMagicNumber:
+		return time.Second
+	case unix.EXFAT_SUPER_MAGIC:
+		return 10 * time.Millisecond
+	case ntfsMagicNumber:
+		return 100 * time.Nanosecond
+	}
+	return time.Nanosecond
+}
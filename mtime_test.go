@@ -0,0 +1,138 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestToleranceOf(t *testing.T) {
+	base := time.Date(2024, 3, 31, 1, 30, 0, 0, time.UTC)
+	tests := []struct {
+		name       string
+		resolution time.Duration
+		a, b       time.Time
+		same       bool
+		newer      bool // a newer than b
+	}{
+		{"fat rounded", 2 * time.Second, base.Add(1999 * time.Millisecond), base, true, false},
+		{"fat apart", 2 * time.Second, base.Add(3 * time.Second), base, false, true},
+		{"fat dst forward", 2 * time.Second, base.Add(time.Hour), base, true, false},
+		{"fat dst back", 2 * time.Second, base.Add(-time.Hour + time.Second), base, true, false},
+		{"fat over an hour", 2 * time.Second, base.Add(time.Hour + 3*time.Second), base, false, true},
+		{"fat two hours", 2 * time.Second, base.Add(2 * time.Hour), base, false, true},
+		{"fat half an hour", 2 * time.Second, base.Add(30 * time.Minute), base, false, true},
+		{"seconds truncated", time.Second, base.Add(999 * time.Millisecond), base, true, false},
+		{"seconds apart", time.Second, base.Add(1001 * time.Millisecond), base, false, true},
+		{"seconds hour apart", time.Second, base.Add(time.Hour), base, false, true},
+		{"exfat truncated", 10 * time.Millisecond, base.Add(9 * time.Millisecond), base, true, false},
+		{"exfat apart", 10 * time.Millisecond, base.Add(11 * time.Millisecond), base, false, true},
+		{"exfat older", 10 * time.Millisecond, base, base.Add(11 * time.Millisecond), false, false},
+		{"ns equal", time.Nanosecond, base, base, true, false},
+		{"ns apart", time.Nanosecond, base.Add(2 * time.Nanosecond), base, false, true},
+		{"unprobed truncated", 0, base.Add(time.Second), base, true, false},
+		{"unprobed apart", 0, base.Add(2 * time.Second), base, false, true},
+		{"unprobed hour apart", 0, base.Add(time.Hour), base, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Session{args: &CopyCmd{}, caps: map[string]destCaps{"/dest": {mtime: tt.resolution}}}
+			tol := s.toleranceOf("/dest")
+			if got := tol.same(tt.a, tt.b); got != tt.same {
+				t.Errorf("same(%v, %v) = %v, want %v", tt.a, tt.b, got, tt.same)
+			}
+			if got := tol.same(tt.b, tt.a); got != tt.same {
+				t.Errorf("same(%v, %v) = %v, want %v", tt.b, tt.a, got, tt.same)
+			}
+			if got := tol.newer(tt.a, tt.b); got != tt.newer {
+				t.Errorf("newer(%v, %v) = %v, want %v", tt.a, tt.b, got, tt.newer)
+			}
+		})
+	}
+}
+
+func TestToleranceOfFlags(t *testing.T) {
+	base := time.Date(2024, 3, 31, 1, 30, 0, 0, time.UTC)
+	caps := map[string]destCaps{"/dest": {mtime: 2 * time.Second}}
+
+	strict := &Session{args: &CopyCmd{CopyFlags: CopyFlags{StrictMtime: true}}, caps: caps}
+	if tol := strict.toleranceOf("/dest"); tol.same(base.Add(time.Nanosecond), base) || !tol.newer(base.Add(time.Nanosecond), base) {
+		t.Errorf("--strict-mtime: got %+v, want nanosecond comparisons", tol)
+	}
+
+	explicit := &Session{args: &CopyCmd{CopyFlags: CopyFlags{MtimeTolerance: 5 * time.Second}}, caps: caps}
+	tol := explicit.toleranceOf("/dest")
+	if !tol.same(base.Add(5*time.Second), base) || tol.same(base.Add(time.Hour), base) {
+		t.Errorf("--mtime-tolerance 5s: got %+v, want 5s without the FAT hour", tol)
+	}
+}
+
+func TestMtimeResolution(t *testing.T) {
+	f, err := os.CreateTemp(t.TempDir(), "mtime")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	r, err := mtimeResolution(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r <= 0 || r > 2*time.Second {
+		t.Errorf("mtimeResolution = %v, want one of %v", r, mtimeResolutions)
+	}
+}
+
+func TestSkipExistingAndUpdate(t *testing.T) {
+	src, dst := t.TempDir(), t.TempDir()
+	name, copied := filepath.Join(src, "f"), filepath.Join(dst, "f")
+	write := func(content string, mtime time.Time) {
+		t.Helper()
+		if err := os.WriteFile(name, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(name, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	check := func(want string) {
+		t.Helper()
+		if got, err := os.ReadFile(copied); err != nil || string(got) != want {
+			t.Errorf("destination holds %q, %v; want %q", got, err, want)
+		}
+	}
+	base := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	write("one", base)
+	if err := run(t, "copy", src, dst); err != nil {
+		t.Fatal(err)
+	}
+	check("one")
+
+	// Same size and mtime: left alone
+	write("two", base)
+	if err := run(t, "copy", src, dst, "--skip-existing"); err != nil {
+		t.Fatal(err)
+	}
+	check("one")
+
+	// Same size, but well past any filesystem's resolution: copied again
+	write("two", base.Add(5*time.Second))
+	if err := run(t, "copy", src, dst, "--skip-existing"); err != nil {
+		t.Fatal(err)
+	}
+	check("two")
+
+	// Older than the destination: --update keeps the destination's
+	write("333", base)
+	if err := run(t, "copy", src, dst, "--update"); err != nil {
+		t.Fatal(err)
+	}
+	check("two")
+
+	write("333", base.Add(10*time.Second))
+	if err := run(t, "copy", src, dst, "--update"); err != nil {
+		t.Fatal(err)
+	}
+	check("333")
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"time"
+
+	"golang.org/x/sys/windows"
+)
+
+// fsMtimeResolution guesses the timestamp resolution of the filesystem
+// holding path from its name, for when it can't be probed. It returns 0
+// if the name can't be read.
+func fsMtimeResolution(path string) time.Duration {
+	dir, _, err := existingParent(path)
+	if err != nil {
+		return 0
+	}
+	name := make([]uint16, windows.MAX_PATH+1)
+	if err := windows.GetVolumeInformation(volumeRoot(dir), nil, 0, nil, nil, nil, &name[0], uint32(len(name))); err != nil {
+		return 0
+	}
+	switch windows.UTF16ToString(name) {
+	case "FAT", "FAT32":
+		return 2 * time.Second
+	case "exFAT":
+		return 10 * time.Millisecond
+	}
+	return 100 * time.Nanosecond // NTFS, ReFS
+}
@@ -0,0 +1,52 @@
+package main
+
+import "os"
+
+// dropEvery is how much is copied between page cache drops with
+// --no-cache. Written pages can only be dropped once they are on the
+// device, so each drop also starts writing back the ones still dirty,
+// and those go at the next drop.
+const dropEvery = 8 << 20
+
+// cacheDropper drops a copy's source and destination files from the page
+// cache as the copy goes. A nil cacheDropper does nothing.
+type cacheDropper struct {
+	files   []*os.File
+	pending int64 // copied since the last drop
+}
+
+// cacheDropper returns a dropper for src and outs with --no-cache, or nil.
+// --direct copies don't go through the cache in the first place.
+func (s *Session) cacheDropper(src *os.File, outs []destFile) *cacheDropper {
+	if !s.args.NoCache || s.args.Direct {
+		return nil
+	}
+	d := &cacheDropper{files: []*os.File{src}}
+	for _, out := range outs {
+		d.files = append(d.files, out.File)
+	}
+	return d
+}
+
+func (d *cacheDropper) copied(n int64) {
+	if d == nil {
+		return
+	}
+	d.pending += n
+	if d.pending >= dropEvery {
+		for _, f := range d.files {
+			dropPages(f, false)
+		}
+		d.pending = 0
+	}
+}
+
+// finish waits for the rest of the copy to be written back and drops it.
+func (d *cacheDropper) finish() {
+	if d == nil {
+		return
+	}
+	for _, f := range d.files {
+		dropPages(f, true)
+	}
+}
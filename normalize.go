@@ -0,0 +1,20 @@
+package main
+
+import "golang.org/x/text/unicode/norm"
+
+// destName returns the name rel gets on the destination under --normalize
+// and --sanitize. Names that look the same but were typed or stored
+// differently, such as "é" as one code point or as "e" plus a combining
+// accent, map to the same destination name.
+func (f *CopyFlags) destName(rel string) string {
+	switch f.Normalize {
+	case "nfc":
+		rel = norm.NFC.String(rel)
+	case "nfd":
+		rel = norm.NFD.String(rel)
+	}
+	if f.Sanitize {
+		rel = sanitizePath(rel)
+	}
+	return rel
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"cmp"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+type orderKey struct {
+	rel   string
+	size  int64
+	mtime time.Time
+}
+
+// publishOrdered sorts the scanned paths by --order and hands them all to
+// the workers at once. Ordering needs the whole scan, so copying starts
+// only once it has finished.
+func (s *Session) publishOrdered() {
+	keys := s.pending
+	var compare func(a, b orderKey) int
+	switch s.args.Order {
+	case "name":
+		compare = func(a, b orderKey) int { return strings.Compare(a.rel, b.rel) }
+	case "dir":
+		compare = func(a, b orderKey) int {
+			return cmp.Or(strings.Compare(filepath.Dir(a.rel), filepath.Dir(b.rel)), strings.Compare(a.rel, b.rel))
+		}
+	case "size":
+		compare = func(a, b orderKey) int { return cmp.Or(cmp.Compare(b.size, a.size), strings.Compare(a.rel, b.rel)) }
+	case "mtime":
+		compare = func(a, b orderKey) int { return cmp.Or(a.mtime.Compare(b.mtime), strings.Compare(a.rel, b.rel)) }
+	}
+	slices.SortStableFunc(keys, compare)
+
+	s.pending = nil
+	s.mu.Lock()
+	for _, k := range keys {
+		s.allPaths = append(s.allPaths, k.rel)
+		s.countScanned(len(s.allPaths)-1, k.size)
+	}
+	s.mu.Unlock()
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"syscall"
+)
+
+// deferJob holds back a file that won't fit on the current destination
+// with --pack greedy, so smaller files can use up the space left first.
+// Held back files are copied to the next destination once every other file
+// has been tried. A file that doesn't fit on a destination that is still
+// empty isn't held back: it needs another disk either way.
+func (s *Session) deferJob(job copyJob, full error) bool {
+	if s.args.Pack != "greedy" {
+		return false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.progress.Local.Files == 0 {
+		return false
+	}
+	if len(s.deferred) == 0 {
+		s.deferredErr = full
+	}
+	s.deferredGen = s.destGen
+	s.deferred = append(s.deferred, job)
+	return true
+}
+
+// takeDeferred hands back the files held back so far. swap is the
+// destination error to switch disks with before retrying them, or nil if
+// the destination has already changed since the last one was held back.
+func (s *Session) takeDeferred() (jobs []copyJob, swap error, gen int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	jobs, s.deferred = s.deferred, nil
+	if len(jobs) == 0 || s.deferredGen != s.destGen {
+		return jobs, nil, s.destGen
+	}
+	dest := 0
+	var de *destError
+	if errors.As(s.deferredErr, &de) {
+		dest = de.dest
+	}
+	swap = &destError{dest, fmt.Errorf("%w: %d files didn't fit and were left for the next destination", syscall.ENOSPC, len(jobs))}
+	return jobs, swap, s.destGen
+}
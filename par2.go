@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// par2Batch limits how many files go into one recovery set so the par2
+// command line stays well under ARG_MAX.
+const par2Batch = 1000
+
+// errParityReserve is reported when a destination still has room for a
+// file but not for the parity data that --par2 will add for it.
+var errParityReserve = fmt.Errorf("%w: keeping room for --par2 recovery data", syscall.ENOSPC)
+
+func checkPar2() error {
+	if _, err := exec.LookPath("par2"); err != nil {
+		return fmt.Errorf("--par2 needs par2cmdline installed: %w", err)
+	}
+	return nil
+}
+
+// parityFits reports whether dest can take a file of size plus recovery
+// data for everything copied to it so far.
+func (s *Session) parityFits(dest string, size int64) bool {
+	if s.args.Par2 == 0 {
+		return true
+	}
+	avail, _, err := s.usableSpace(dest)
+	if err != nil {
+		return true // let the copy itself fail
+	}
+	s.mu.Lock()
+	written := s.progress.Local.Bytes
+	s.mu.Unlock()
+
+	// par2 adds a few percent of overhead on top of the recovery blocks
+	reserve := (written + size) * int64(s.args.Par2) * 105 / 100 / 100
+	return uint64(size+reserve) <= avail
+}
+
+// writeParity runs par2 over the files copied to dest since the last call,
+// claiming them under the lock like writeSums does.
+func (s *Session) writeParity(dest string) {
+	if s.args.Par2 == 0 || dest == "" {
+		return
+	}
+
+	s.mu.Lock()
+	var files []string
+	for i := range s.placed {
+		p := &s.placed[i]
+		switch {
+		case p.dest == dest && !p.destParity:
+			p.destParity = true
+		case p.mirror == dest && !p.mirrorParity:
+			p.mirrorParity = true
+		default:
+			continue
+		}
+		path := filepath.Join(dest, p.dstRel)
+		if info, err := os.Lstat(path); err == nil && info.Mode().IsRegular() {
+			files = append(files, path) // not symlinks or special files
+		}
+	}
+	s.mu.Unlock()
+
+	stamp := time.Now().Format("20060102-150405")
+	for n := 0; n*par2Batch < len(files); n++ {
+		batch := files[n*par2Batch : min((n+1)*par2Batch, len(files))]
+		name := filepath.Join(dest, fmt.Sprintf("splitcopy-%s-%d.par2", stamp, n+1))
+		fmt.Fprintf(s.out, "\rCreating %d%% recovery data for %d files: %s\033[K\n", s.args.Par2, len(batch), name)
+
+		args := append([]string{"create", "-q", fmt.Sprintf("-r%d", s.args.Par2), "-B" + dest, name, "--"}, batch...)
+		cmd := exec.Command("par2", args...)
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			fmt.Fprintf(s.out, "par2 failed on %s: %v: %s\n", dest, err, strings.TrimSpace(string(out)))
+			s.mu.Lock()
+			s.progress.Errors++
+			s.emit(Event{Type: EventError, Path: name, Detail: err.Error()})
+			s.mu.Unlock()
+			removeParity(name)
+			return
+		}
+	}
+}
+
+// removeParity deletes the index and volume files of a failed par2 set.
+func removeParity(name string) {
+	matches, _ := filepath.Glob(strings.TrimSuffix(name, ".par2") + ".vol*.par2")
+	for _, m := range append(matches, name) {
+		_ = os.Remove(m)
+	}
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+)
+
+// partialSuffix marks a copy that ran out of space with --partial, so it
+// can't be mistaken for a complete file.
+const partialSuffix = ".splitcopy-partial"
+
+// keepsPartial reports whether a failed copy to dsts should be kept to be
+// continued later rather than deleted: after running out of space, or
+// to be resumed by --retries.
+func (s *Session) keepsPartial(dsts []string, err error) bool {
+	retried := s.args.Retries > 0 && transient(err)
+	return s.args.Partial && len(dsts) == 1 && s.args.PipeThrough == "" && (isNoSpace(err) || retried)
+}
+
+// keepPartial renames a copy of dst that ran out of space, written to
+// path, out of the way.
+func keepPartial(path, dst string) bool {
+	info, err := os.Stat(path)
+	if err != nil || info.Size() == 0 {
+		return false
+	}
+	return os.Rename(path, dst+partialSuffix) == nil
+}
+
+// resumePartial continues a copy to dst that an earlier attempt left as a
+// partial file, once the end of what it holds matches the source. It
+// returns false if there was no usable partial file, removing one that
+// doesn't match.
+func (s *Session) resumePartial(in *os.File, src, dst string, sInfo os.FileInfo, watch *stallWatch) (res copyResult, ok bool, err error) {
+	partial := dst + partialSuffix
+	pInfo, err := os.Stat(partial)
+	if err != nil {
+		return res, false, nil
+	}
+	offset := pInfo.Size()
+	if offset > sInfo.Size() || !tailMatches(in, partial, offset, int64(s.args.PartialCheck)) {
+		s.mu.Lock()
+		fmt.Fprintf(s.out, "\r%s: partial copy doesn't match the source, starting over\033[K\n", dst)
+		s.mu.Unlock()
+		_ = os.Remove(partial)
+		return res, false, nil
+	}
+
+	s.mu.Lock()
+	fmt.Fprintf(s.out, "\rresuming %s at %s\033[K\n", dst, humanBytes(offset))
+	s.mu.Unlock()
+
+	f, err := os.OpenFile(partial, os.O_WRONLY, 0)
+	if err != nil {
+		return res, true, &destError{0, err}
+	}
+	out := destFile{f, 0}
+	defer func() {
+		if out.File != nil {
+			out.Close()
+		}
+	}()
+	if err := preallocate(f, sInfo.Size()); err != nil {
+		return res, true, &destError{0, err}
+	}
+
+	// The hash for --verify and --sums covers the part written before too
+	var sum hash.Hash
+	if s.args.Verify || s.args.Sums {
+		h := newAsyncHash(s.hash.new())
+		defer h.close()
+		sum = h
+		if _, err := io.Copy(sum, io.NewSectionReader(in, 0, offset)); err != nil {
+			return res, true, err
+		}
+	}
+	if _, err := in.Seek(offset, io.SeekStart); err != nil {
+		return res, true, err
+	}
+	if _, err := out.Seek(offset, io.SeekStart); err != nil {
+		return res, true, err
+	}
+
+	r := s.sourceReader(in, []destFile{out})
+	r.watch = watch
+	defer func() { s.partialBytes.Add(-r.n) }()
+	var reader io.Reader = r
+	if sum != nil {
+		reader = io.TeeReader(r, sum)
+	}
+	if _, err := copyData([]destFile{out}, reader, -1, s.copyBuffer()); err != nil {
+		return res, true, err
+	} else if !watch.finishing() {
+		return res, true, errStalled
+	}
+	r.nocache.finish()
+	if sum != nil {
+		res.written = sum.Sum(nil)
+	}
+	if err := s.syncFile(out); err != nil {
+		return res, true, err
+	}
+	err = out.File.Close()
+	out.File = nil
+	if err != nil {
+		return res, true, &destError{0, err}
+	}
+	if err := s.commit([]string{partial}, []string{dst}); err != nil {
+		return res, true, err
+	}
+	return res, true, s.finishCopy(src, []string{dst}, sInfo, &res)
+}
+
+// tailMatches compares the last n bytes before offset in src and partial.
+func tailMatches(src *os.File, partial string, offset, n int64) bool {
+	n = min(n, offset)
+	if n <= 0 {
+		return true
+	}
+	f, err := os.Open(partial)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	want := make([]byte, n)
+	got := make([]byte, n)
+	if _, err := src.ReadAt(want, offset-n); err != nil {
+		return false
+	}
+	if _, err := f.ReadAt(got, offset-n); err != nil {
+		return false
+	}
+	return bytes.Equal(want, got)
+}
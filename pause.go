@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// watchPause toggles the paused state on SIGUSR2 and whenever the
+// --control-file is created or touched.
+func (s *Session) watchPause() {
+	usr2 := make(chan os.Signal, 1)
+	notifyPause(usr2)
+
+	var poll <-chan time.Time
+	var lastMod time.Time
+	if s.args.ControlFile != "" {
+		if info, err := os.Stat(s.args.ControlFile); err == nil {
+			lastMod = info.ModTime()
+		}
+		ticker := time.NewTicker(time.Second)
+		poll = ticker.C
+	}
+
+	go func() {
+		for {
+			select {
+			case <-usr2:
+				s.togglePause()
+			case <-poll:
+				info, err := os.Stat(s.args.ControlFile)
+				if err == nil && !info.ModTime().Equal(lastMod) {
+					lastMod = info.ModTime()
+					s.togglePause()
+				}
+			case <-s.stopCh:
+				return
+			}
+		}
+	}()
+}
+
+func (s *Session) togglePause() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.progress.pausedAt.IsZero() {
+		s.progress.pausedAt = time.Now()
+		fmt.Fprint(s.out, "\rPausing after the files in progress...\033[K\n")
+	} else {
+		s.progress.pausedFor += time.Since(s.progress.pausedAt)
+		s.progress.pausedAt = time.Time{}
+		s.progress.rate.reset()
+		s.pauseCond.Broadcast()
+		fmt.Fprint(s.out, "\rResumed\033[K\n")
+	}
+	s.printProgress()
+}
+
+// waitWhilePaused blocks a worker between files until the session is
+// resumed or stopped.
+func (s *Session) waitWhilePaused() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for !s.progress.pausedAt.IsZero() && !s.interrupted.Load() {
+		s.pauseCond.Wait()
+	}
+}
+
+// activeTime is how long the current destination has been copied to, not
+// counting time spent paused.
+func (p *Progress) activeTime() time.Duration {
+	d := time.Since(p.start) - p.pausedFor
+	if !p.pausedAt.IsZero() {
+		d -= time.Since(p.pausedAt)
+	}
+	return d
+}
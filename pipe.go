@@ -0,0 +1,57 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+)
+
+var errPipeFailed = errors.New("pipe-through failed")
+
+// recordingWriter remembers the first write error so a full destination
+// isn't masked by the filter dying of SIGPIPE.
+type recordingWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (r *recordingWriter) Write(p []byte) (int, error) {
+	n, err := r.w.Write(p)
+	if err != nil && r.err == nil {
+		r.err = err
+	}
+	return n, err
+}
+
+// pipeThrough streams src through a shell command and writes the command's
+// output to w. It returns the SHA-256 of the transformed output so that
+// verification can check the destination against what was written rather
+// than the untransformed source.
+func pipeThrough(command string, src io.Reader, w io.Writer, alg hashAlg) ([]byte, error) {
+	var stderr bytes.Buffer
+	h := alg.new()
+	out := &recordingWriter{w: w}
+
+	cmd := exec.Command("sh", "-c", command)
+	cmd.Stdin = src
+	cmd.Stdout = io.MultiWriter(out, h)
+	cmd.Stderr = &stderr
+
+	err := cmd.Run()
+	if out.err != nil {
+		return nil, out.err
+	}
+	if errors.Is(err, errInterrupted) {
+		return nil, err
+	}
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("%w: %v: %s", errPipeFailed, err, msg)
+		}
+		return nil, fmt.Errorf("%w: %v", errPipeFailed, err)
+	}
+	return h.Sum(nil), nil
+}
@@ -0,0 +1,79 @@
+package main
+
+import "io"
+
+// defaultBufferSize is used for each copy buffer when neither
+// --buffer-size nor a --media-type preset sets one.
+const defaultBufferSize = 128 << 10
+
+// filled is a buffer handed from the reading side of copyPipelined to the
+// writing side.
+type filled struct {
+	buf []byte
+	n   int
+	err error
+}
+
+// copyPipelined copies r to w like io.CopyBuffer, but fills the next
+// buffer from r while the previous one is still being written, so a slow
+// destination and the source are kept busy at the same time. buf is one of
+// the two buffers; the other is allocated to match. It doesn't return
+// until the reading goroutine has stopped, so r can be used again or
+// closed right after.
+func copyPipelined(w io.Writer, r io.Reader, buf []byte) (written int64, err error) {
+	if len(buf) == 0 {
+		buf = make([]byte, defaultBufferSize)
+	}
+	free := make(chan []byte, 2)
+	free <- buf
+	free <- make([]byte, len(buf))
+	full := make(chan filled)
+	stop := make(chan struct{})
+	stopped := make(chan struct{})
+	defer func() {
+		close(stop)
+		<-stopped
+	}()
+
+	go func() {
+		defer close(stopped)
+		for {
+			var b []byte
+			select {
+			case b = <-free:
+			case <-stop:
+				return
+			}
+			// Filling whole buffers keeps writes large even when the
+			// source returns short reads
+			n, err := io.ReadFull(r, b)
+			select {
+			case full <- filled{b, n, err}:
+			case <-stop:
+				return
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	for {
+		f := <-full
+		if f.n > 0 {
+			m, err := w.Write(f.buf[:f.n])
+			written += int64(m)
+			if err != nil {
+				return written, err
+			} else if m < f.n {
+				return written, io.ErrShortWrite
+			}
+		}
+		if f.err == io.EOF || f.err == io.ErrUnexpectedEOF {
+			return written, nil
+		} else if f.err != nil {
+			return written, f.err
+		}
+		free <- f.buf
+	}
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+)
+
+type PlanCmd struct {
+	Source string `arg:"" help:"Source directory." type:"existingdir"`
+
+	ScanFlags `embed:""`
+
+	DiskSize  ByteSize `required:"" placeholder:"SIZE" help:"Usable capacity of each disk, e.g. 4TB or 3.6TiB."`
+	BlockSize ByteSize `default:"4KiB" placeholder:"SIZE" help:"Round each file up to this allocation unit when packing."`
+	OutputDir string   `default:"." type:"existingdir" help:"Directory to write disk1.txt, disk2.txt, ... to."`
+}
+
+type planFile struct {
+	rel  string
+	size int64 // rounded up to the block size
+}
+
+type planDisk struct {
+	files []string
+	used  int64
+}
+
+func (p *PlanCmd) Validate() error {
+	return p.ScanFlags.validate()
+}
+
+// Run scans the source and packs its files onto as few disks as possible.
+// Each disk's list can be copied later with apply or --resume.
+func (p *PlanCmd) Run() error {
+	s := newSession(&CopyCmd{Source: p.Source, ScanFlags: p.ScanFlags})
+	go s.scan()
+	select {
+	case <-s.scanDone:
+	case <-s.sigIntChan:
+		return &exitError{130, errInterrupted}
+	}
+	if s.scanErr != nil {
+		return s.scanErr
+	}
+	if err := s.checkSelected(p.StartIndex); err != nil {
+		return err
+	}
+
+	block := max(int64(p.BlockSize), 1)
+	var files []planFile
+	var tooBig []string
+	for _, rel := range s.allPaths[min(p.StartIndex, len(s.allPaths)):] {
+		info, err := p.statSource(filepath.Join(p.Source, rel))
+		if err != nil {
+			fmt.Println(err)
+			continue
+		}
+		size := (info.Size() + block - 1) / block * block
+		if size > int64(p.DiskSize) {
+			tooBig = append(tooBig, rel)
+			continue
+		}
+		files = append(files, planFile{rel, size})
+	}
+
+	source, err := filepath.Abs(p.Source)
+	if err != nil {
+		return err
+	}
+	disks := packDisks(files, int64(p.DiskSize))
+	for i, d := range disks {
+		slices.Sort(d.files)
+		name := filepath.Join(p.OutputDir, fmt.Sprintf("disk%d.txt", i+1))
+		if err := writeLines(name, append([]string{planHeader + source}, d.files...)); err != nil {
+			return err
+		}
+		fmt.Printf("%s: %d files, %s (%.1f%% full)\n", name, len(d.files), humanBytes(d.used), 100*float64(d.used)/float64(p.DiskSize))
+	}
+	fmt.Printf("Needs %d disks of %s\n", len(disks), humanBytes(int64(p.DiskSize)))
+
+	if len(tooBig) > 0 {
+		for _, rel := range tooBig {
+			fmt.Printf("larger than a disk: %s\n", rel)
+		}
+		return fmt.Errorf("%d files don't fit on a single disk and were left out of the plan", len(tooBig))
+	}
+	return nil
+}
+
+// packDisks is first-fit decreasing: largest files first, each onto the
+// first disk with room. It uses at most 11/9 of the optimal number of disks.
+func packDisks(files []planFile, capacity int64) []*planDisk {
+	slices.SortStableFunc(files, func(a, b planFile) int {
+		return cmp.Compare(b.size, a.size)
+	})
+
+	var disks []*planDisk
+	for _, f := range files {
+		i := slices.IndexFunc(disks, func(d *planDisk) bool { return d.used+f.size <= capacity })
+		if i < 0 {
+			disks = append(disks, &planDisk{})
+			i = len(disks) - 1
+		}
+		disks[i].files = append(disks[i].files, f.rel)
+		disks[i].used += f.size
+	}
+	return disks
+}
+
+func writeLines(name string, lines []string) error {
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	for _, line := range lines {
+		fmt.Fprintln(f, line)
+	}
+	return f.Close()
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// preallocates reports whether copies of a file should have their space
+// reserved before any data is written, so a file that won't fit fails at
+// once instead of after writing most of it. Sparse copies are left alone:
+// reserving the whole size would fill in the holes.
+func (s *Session) preallocates(info os.FileInfo) bool {
+	return !s.args.NoPreallocate && s.args.PipeThrough == "" && s.dense(info)
+}
+
+// dense reports whether every byte of a file is written when it is
+// copied, rather than holes being kept or made.
+func (s *Session) dense(info os.FileInfo) bool {
+	if s.args.Sparse == "always" {
+		return false
+	}
+	if s.args.Sparse == "never" || info.Size() < int64(s.args.SparseMinSize) {
+		return true
+	}
+	used, ok := diskUsage(info)
+	return !ok || used >= info.Size()
+}
+
+// preallocate reserves size bytes for f without changing its length.
+// Filesystems that can't reserve space are written to as usual.
+func preallocate(f *os.File, size int64) error {
+	if size == 0 {
+		return nil
+	}
+	err := allocate(f, size)
+	if errors.Is(err, syscall.EOPNOTSUPP) || errors.Is(err, syscall.ENOSYS) || errors.Is(err, syscall.EINVAL) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// allocate sets the allocation size of f, which reserves clusters for it
+// without changing its length. Shares and filesystems that can't do that
+// report EOPNOTSUPP, like elsewhere.
+func allocate(f *os.File, size int64) error {
+	info := struct{ AllocationSize int64 }{size}
+	err := windows.SetFileInformationByHandle(windows.Handle(f.Fd()), windows.FileAllocationInfo,
+		(*byte)(unsafe.Pointer(&info)), uint32(unsafe.Sizeof(info)))
+	if errors.Is(err, windows.ERROR_NOT_SUPPORTED) || errors.Is(err, windows.ERROR_INVALID_PARAMETER) {
+		return syscall.EOPNOTSUPP
+	} else if err != nil {
+		return &os.SyscallError{Syscall: "SetFileInformationByHandle", Err: err}
+	}
+	return nil
+}
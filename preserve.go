@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/alecthomas/kong"
+)
+
+// Preserve is the comma-separated --preserve list of metadata to carry
+// over, named like cp's.
+type Preserve struct {
+	Mode       bool
+	Ownership  bool
+	Timestamps bool
+	Xattr      bool
+	ACL        bool
+	Links      bool
+}
+
+func (p *Preserve) Decode(ctx *kong.DecodeContext) error {
+	var value string
+	if err := ctx.Scan.PopValueInto("attributes", &value); err != nil {
+		return err
+	}
+
+	*p = Preserve{}
+	for _, name := range strings.Split(value, ",") {
+		switch strings.TrimSpace(name) {
+		case "mode":
+			p.Mode = true
+		case "ownership":
+			p.Ownership = true
+		case "timestamps":
+			p.Timestamps = true
+		case "xattr":
+			p.Xattr = true
+		case "acl":
+			p.ACL = true
+		case "links":
+			p.Links = true
+		case "all":
+			*p = Preserve{true, true, true, true, true, true}
+		case "none", "":
+		default:
+			return fmt.Errorf("unknown attribute %q (mode, ownership, timestamps, xattr, acl, links, all, none)", name)
+		}
+	}
+	return nil
+}
+
+// The older single-purpose flags add to --preserve.
+
+func (c *CopyFlags) keepXattrs() bool    { return c.Xattrs || c.Preserve.Xattr }
+func (c *CopyFlags) keepACLs() bool      { return c.ACLs || c.Preserve.ACL }
+func (c *CopyFlags) keepHardLinks() bool { return c.HardLinks || c.Preserve.Links }
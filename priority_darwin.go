@@ -0,0 +1,30 @@
+package main
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// From sys/resource.h
+const (
+	prioDarwinProcess = 4
+	prioDarwinBG      = 0x1000
+)
+
+// setPriority applies --nice and --ionice. macOS has no I/O classes:
+// idle moves the process to the background band, which throttles its disk
+// I/O, and best-effort is the default already.
+func setPriority(nice int, ionice string) error {
+	if nice != 0 {
+		if err := unix.Setpriority(unix.PRIO_PROCESS, 0, nice); err != nil {
+			return &os.SyscallError{Syscall: "setpriority", Err: err}
+		}
+	}
+	if ionice == "idle" {
+		if err := unix.Setpriority(prioDarwinProcess, 0, prioDarwinBG); err != nil {
+			return &os.SyscallError{Syscall: "setpriority", Err: err}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"os"
+	"strconv"
+
+	"golang.org/x/sys/unix"
+)
+
+// From linux/ioprio.h
+const (
+	ioprioClassShift = 13
+	ioprioClassBE    = 2
+	ioprioClassIdle  = 3
+	ioprioWhoProcess = 1
+)
+
+// setPriority applies --nice and --ionice. On Linux both apply to a single
+// thread, so every thread the runtime has started gets them; threads
+// started later inherit them.
+func setPriority(nice int, ionice string) error {
+	tids := []int{0}
+	if entries, err := os.ReadDir("/proc/self/task"); err == nil {
+		tids = tids[:0]
+		for _, e := range entries {
+			if tid, err := strconv.Atoi(e.Name()); err == nil {
+				tids = append(tids, tid)
+			}
+		}
+	}
+
+	var prio int
+	switch ionice {
+	case "idle":
+		prio = ioprioClassIdle << ioprioClassShift
+	case "best-effort":
+		prio = ioprioClassBE<<ioprioClassShift | 7 // the lowest level
+	}
+	for _, tid := range tids {
+		if nice != 0 {
+			if err := unix.Setpriority(unix.PRIO_PROCESS, tid, nice); err != nil {
+				return &os.SyscallError{Syscall: "setpriority", Err: err}
+			}
+		}
+		if prio != 0 {
+			if _, _, errno := unix.Syscall(unix.SYS_IOPRIO_SET, ioprioWhoProcess, uintptr(tid), uintptr(prio)); errno != 0 {
+				return &os.SyscallError{Syscall: "ioprio_set", Err: errno}
+			}
+		}
+	}
+	return nil
+}
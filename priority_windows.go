@@ -0,0 +1,30 @@
+package main
+
+import (
+	"os"
+
+	"golang.org/x/sys/windows"
+)
+
+// setPriority applies --nice and --ionice. Windows has a few priority
+// classes rather than nice levels: up to 9 maps to below normal and 10 or
+// more to idle. idle I/O puts the process in background mode, which lowers
+// its I/O and memory priority; best-effort is the default already.
+func setPriority(nice int, ionice string) error {
+	self := windows.CurrentProcess()
+	if nice != 0 {
+		class := uint32(windows.BELOW_NORMAL_PRIORITY_CLASS)
+		if nice >= 10 {
+			class = windows.IDLE_PRIORITY_CLASS
+		}
+		if err := windows.SetPriorityClass(self, class); err != nil {
+			return &os.SyscallError{Syscall: "SetPriorityClass", Err: err}
+		}
+	}
+	if ionice == "idle" {
+		if err := windows.SetPriorityClass(self, windows.PROCESS_MODE_BACKGROUND_BEGIN); err != nil {
+			return &os.SyscallError{Syscall: "SetPriorityClass", Err: err}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// rateLimiter is a token bucket shared by all workers for --bwlimit. A
+// nil rateLimiter doesn't limit anything.
+type rateLimiter struct {
+	mu     sync.Mutex
+	rate   float64 // bytes per second
+	tokens float64 // may go negative: data already read, not yet paid for
+	last   time.Time
+}
+
+func newRateLimiter(rate int64) *rateLimiter {
+	if rate <= 0 {
+		return nil
+	}
+	return &rateLimiter{rate: float64(rate), tokens: float64(rate), last: time.Now()}
+}
+
+// burst is how much can be copied at once after being idle, and the
+// largest single read worth making. It stays a multiple of directAlign so
+// --direct reads remain aligned.
+func (l *rateLimiter) burst() int64 {
+	return max(int64(l.rate/4)/directAlign*directAlign, directAlign)
+}
+
+// wait takes n bytes from the bucket and sleeps until they are covered,
+// returning early with false once stop is set.
+func (l *rateLimiter) wait(n int64, stop *atomic.Bool) bool {
+	if l == nil || n <= 0 {
+		return true
+	}
+	l.mu.Lock()
+	now := time.Now()
+	l.tokens = min(l.tokens+now.Sub(l.last).Seconds()*l.rate, float64(l.burst()))
+	l.last = now
+	l.tokens -= float64(n)
+	delay := time.Duration(-l.tokens / l.rate * float64(time.Second))
+	l.mu.Unlock()
+
+	// Sleep in steps so an interrupt doesn't wait for a slow link
+	for delay > 0 {
+		if stop.Load() {
+			return false
+		}
+		step := min(delay, 100*time.Millisecond)
+		time.Sleep(step)
+		delay -= step
+	}
+	return true
+}
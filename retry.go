@@ -0,0 +1,57 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"syscall"
+	"time"
+)
+
+// maxRetryDelay caps the doubling of --retry-delay.
+const maxRetryDelay = 5 * time.Minute
+
+// transientErrors are what USB disks and network mounts return when they
+// drop out for a moment and then recover.
+var transientErrors = []syscall.Errno{
+	syscall.EIO, syscall.ETIMEDOUT, syscall.EAGAIN, syscall.ESTALE,
+	syscall.ECONNRESET, syscall.ECONNABORTED, syscall.ENOTCONN,
+	syscall.EHOSTDOWN, syscall.EHOSTUNREACH, syscall.ENETDOWN, syscall.ENETUNREACH,
+}
+
+func transient(err error) bool {
+	if errors.Is(err, errStalled) {
+		return true
+	}
+	for _, errno := range transientErrors {
+		if errors.Is(err, errno) {
+			return true
+		}
+	}
+	return false
+}
+
+// retry waits before another attempt at a file that failed with a
+// transient error, doubling the delay each time, and reports whether
+// --retries allows one. attempt counts the retries made so far.
+func (s *Session) retry(rel string, err error, attempt *int) bool {
+	if *attempt >= s.args.Retries || !transient(err) {
+		return false
+	}
+	*attempt++
+	delay := s.args.RetryDelay
+	for i := 1; i < *attempt && delay < maxRetryDelay; i++ {
+		delay = min(delay*2, maxRetryDelay)
+	}
+
+	s.mu.Lock()
+	fmt.Fprintf(s.out, "\r%s: %v; retrying in %s (%d of %d)\033[K\n", rel, err, delay, *attempt, s.args.Retries)
+	s.progress.Retries++
+	s.emit(Event{Type: EventRetry, Path: rel, Detail: err.Error()})
+	s.mu.Unlock()
+
+	select {
+	case <-time.After(delay):
+	case <-s.stopCh:
+	}
+	return true
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// span is a range of bytes in a file.
+type span struct {
+	off, len int64
+}
+
+// salvageReader reads a failing source for --salvage: a read error skips
+// ahead by block bytes, which are returned as zeros and recorded as
+// damaged, instead of failing the copy. It reads at the file's offset, so
+// the sparse copy can still seek the file between reads.
+type salvageReader struct {
+	f       *os.File
+	size    int64
+	block   int64
+	damaged []span
+}
+
+func (r *salvageReader) Read(p []byte) (int, error) {
+	n, err := r.f.Read(p)
+	if err == nil || errors.Is(err, io.EOF) || n > 0 {
+		return n, err
+	}
+	off, serr := r.f.Seek(0, io.SeekCurrent)
+	if serr != nil || off >= r.size {
+		return 0, err
+	}
+
+	skip := min(r.block, r.size-off, int64(len(p)))
+	if _, serr := r.f.Seek(off+skip, io.SeekStart); serr != nil {
+		return 0, err
+	}
+	clear(p[:skip])
+	if last := len(r.damaged) - 1; last >= 0 && r.damaged[last].off+r.damaged[last].len == off {
+		r.damaged[last].len += skip
+	} else {
+		r.damaged = append(r.damaged, span{off, skip})
+	}
+	return int(skip), nil
+}
+
+// damagedBytes is how much of the file couldn't be read.
+func damagedBytes(spans []span) int64 {
+	var n int64
+	for _, s := range spans {
+		n += s.len
+	}
+	return n
+}
+
+// saveDamaged writes the ranges --salvage couldn't read, one per line as
+// path, offset, and length separated by tabs, to SOURCE.damaged.
+func (s *Session) saveDamaged() {
+	s.mu.Lock()
+	var lines []string
+	for _, d := range s.damaged {
+		for _, sp := range d.spans {
+			lines = append(lines, fmt.Sprintf("%s\t%d\t%d", d.rel, sp.off, sp.len))
+		}
+	}
+	s.mu.Unlock()
+	s.savePaths(".damaged", "Damaged", lines)
+}
+
+// damagedFile is a file copied by --salvage with ranges filled with zeros.
+type damagedFile struct {
+	rel   string
+	spans []span
+}
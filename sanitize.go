@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// namesFile lists, on each destination under --sanitize, the files that
+// were written under a different name than the source's.
+const namesFile = "splitcopy-names.tsv"
+
+// Characters FAT, exFAT, and NTFS reject in names, and the full-width
+// lookalikes they are written as instead
+var sanitizer = strings.NewReplacer(
+	`:`, "：", `?`, "？", `*`, "＊", `"`, "＂",
+	`<`, "＜", `>`, "＞", `|`, "｜", `\`, "＼",
+)
+
+var reservedNames = map[string]bool{
+	"CON": true, "PRN": true, "AUX": true, "NUL": true,
+	"COM1": true, "COM2": true, "COM3": true, "COM4": true, "COM5": true, "COM6": true, "COM7": true, "COM8": true, "COM9": true,
+	"LPT1": true, "LPT2": true, "LPT3": true, "LPT4": true, "LPT5": true, "LPT6": true, "LPT7": true, "LPT8": true, "LPT9": true,
+}
+
+// sanitizePath applies sanitizeName to each element of rel.
+func sanitizePath(rel string) string {
+	parts := strings.Split(rel, string(filepath.Separator))
+	for i, name := range parts {
+		parts[i] = sanitizeName(name)
+	}
+	return strings.Join(parts, string(filepath.Separator))
+}
+
+// sanitizeName rewrites a name Windows filesystems can't store into one
+// they can. The same name always comes out the same way, so resuming and
+// verifying find the files a previous run wrote. Control characters
+// become their Unicode control pictures, a trailing dot or space (which
+// Windows strips) becomes "．" or "␠", and a reserved device name such as
+// CON or nul.txt gets an underscore after its stem.
+func sanitizeName(name string) string {
+	name = sanitizer.Replace(name)
+	name = strings.Map(func(r rune) rune {
+		if r < 0x20 {
+			return 0x2400 + r
+		}
+		return r
+	}, name)
+
+	switch {
+	case strings.HasSuffix(name, "."):
+		name = strings.TrimSuffix(name, ".") + "．"
+	case strings.HasSuffix(name, " "):
+		name = strings.TrimSuffix(name, " ") + "␠"
+	}
+
+	stem, ext, _ := strings.Cut(name, ".")
+	if reservedNames[strings.ToUpper(strings.TrimRight(stem, " "))] {
+		name = stem + "_"
+		if ext != "" {
+			name += "." + ext
+		}
+	}
+	return name
+}
+
+// writeRenames appends a line to namesFile on dest for every file copied
+// there since the last call whose destination name isn't the source's,
+// so the original names can be put back after copying off the disk.
+func (s *Session) writeRenames(dest string) {
+	if !s.args.Sanitize || dest == "" {
+		return
+	}
+
+	s.mu.Lock()
+	var lines []string
+	for i := range s.placed {
+		p := &s.placed[i]
+		switch {
+		case p.dstRel == "" || p.dstRel == p.rel || p.dstRel == p.rel+s.args.PipeSuffix:
+			continue
+		case p.dest == dest && !p.destNamed:
+			p.destNamed = true
+		case p.mirror == dest && !p.mirrorNamed:
+			p.mirrorNamed = true
+		default:
+			continue
+		}
+		lines = append(lines, namesLine(p.dstRel, p.rel))
+	}
+	s.mu.Unlock()
+	if len(lines) == 0 {
+		return
+	}
+
+	name := filepath.Join(dest, namesFile)
+	if err := appendLines(name, lines); err != nil {
+		fmt.Fprintf(s.out, "\rfailed to write %s: %v\033[K\n", name, err)
+		return
+	}
+	fmt.Fprintf(s.out, "\rRenamed files: %d listed in %s\033[K\n", len(lines), name)
+}
+
+// namesLine formats a tab-separated destination name and source path,
+// escaped like --porcelain output.
+func namesLine(dstRel, rel string) string {
+	return porcelainEscaper.Replace(filepath.ToSlash(dstRel)) + "\t" + porcelainEscaper.Replace(filepath.ToSlash(rel))
+}
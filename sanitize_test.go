@@ -0,0 +1,32 @@
+package main
+
+import "testing"
+
+func TestSanitizeName(t *testing.T) {
+	tests := []struct{ in, want string }{
+		{"plain.txt", "plain.txt"},
+		{"a:b", "a：b"},
+		{`what? "really" <yes>|*no*\`, `what？ ＂really＂ ＜yes＞｜＊no＊＼`},
+		{"tab\there", "tab␉here"},
+		{"new\nline", "new␊line"},
+		{"ends with dot.", "ends with dot．"},
+		{"ends with space ", "ends with space␠"},
+		{"CON", "CON_"},
+		{"con.txt", "con_.txt"},
+		{"nul.tar.gz", "nul_.tar.gz"},
+		{"COM1", "COM1_"},
+		{"LPT9.log", "LPT9_.log"},
+		{"COM10", "COM10"},
+		{"CONSOLE", "CONSOLE"},
+		{"aux ", "aux␠"},
+		{"é", "é"},
+	}
+	for _, tt := range tests {
+		if got := sanitizeName(tt.in); got != tt.want {
+			t.Errorf("sanitizeName(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+		if got := sanitizeName(sanitizeName(tt.in)); got != tt.want {
+			t.Errorf("sanitizeName isn't idempotent for %q: %q", tt.in, got)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+)
+
+const scanCacheVersion = 1
+
+// scanCache is the result of a full walk of the source. Filters on file
+// attributes such as size are applied when the list is replayed since
+// changing a file doesn't change its directory. Adding, removing,
+// or renaming an entry updates its parent directory's mtime, so the file
+// list is still valid as long as every walked directory has the mtime it
+// had when the cache was written.
+type scanCache struct {
+	Version       int
+	Source        string
+	ExcludeHidden bool
+	Filters       []string
+	NoIgnoreFiles bool
+	Dirs          map[string]int64 // relative path to mtime in nanoseconds
+	IgnoreFiles   map[string]int64 // directories with a .splitcopyignore, to its mtime
+	Files         []string
+}
+
+func readScanCache(name string) (*scanCache, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var c scanCache
+	if err := gob.NewDecoder(f).Decode(&c); err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return &c, nil
+}
+
+func (c *scanCache) write(name string) error {
+	tmp := name + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if err := gob.NewEncoder(f).Encode(c); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, name)
+}
+
+var errStaleScanCache = errors.New("source changed")
+
+// validate stats every cached directory, which is much cheaper than
+// listing them all again.
+func (c *scanCache) validate(source string, f *ScanFlags) error {
+	if c.Version != scanCacheVersion || c.Source != source || c.ExcludeHidden != f.ExcludeHidden || c.NoIgnoreFiles != f.NoIgnoreFiles || !slices.Equal(c.Filters, f.filterKey()) {
+		return errStaleScanCache
+	}
+	for rel, mtime := range c.Dirs {
+		info, err := os.Stat(filepath.Join(source, rel))
+		if err != nil || !info.IsDir() || info.ModTime().UnixNano() != mtime {
+			return errStaleScanCache
+		}
+	}
+	// Editing an ignore file doesn't touch its directory
+	for rel, mtime := range c.IgnoreFiles {
+		info, err := os.Stat(filepath.Join(source, rel, ignoreFileName))
+		if err != nil || info.ModTime().UnixNano() != mtime {
+			return errStaleScanCache
+		}
+	}
+	return nil
+}
+
+// loadScanCache replays a valid cached file list. It returns false when the
+// source has to be walked instead.
+func (s *Session) loadScanCache() bool {
+	if s.args.ScanCache == "" || s.args.NoScanCache {
+		return false
+	}
+
+	c, err := readScanCache(s.args.ScanCache)
+	if err == nil {
+		err = c.validate(s.args.Source, &s.args.ScanFlags)
+	}
+	if err != nil {
+		if !os.IsNotExist(err) {
+			fmt.Fprintf(s.out, "Not using scan cache: %v\n", err)
+		}
+		return false
+	}
+
+	s.mu.Lock()
+	for rel := range c.Dirs {
+		if rel != "." {
+			s.scanDirs = append(s.scanDirs, rel)
+		}
+	}
+	s.mu.Unlock()
+	for _, rel := range c.Files {
+		s.addSelected(rel, nil)
+	}
+	return true
+}
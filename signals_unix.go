@@ -0,0 +1,31 @@
+//go:build unix
+
+package main
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+func (s *Session) watchResize() {
+	// Initialize width
+	s.updateWidth()
+
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGWINCH)
+	go func() {
+		for range sigChan {
+			s.updateWidth()
+		}
+	}()
+}
+
+// notifyPause sends SIGUSR2 to c.
+func notifyPause(c chan<- os.Signal) {
+	signal.Notify(c, syscall.SIGUSR2)
+}
+
+// enableEscapes does nothing: Unix terminals understand the escape
+// sequences used to redraw the progress line already.
+func enableEscapes(f *os.File) {}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"os"
+	"time"
+
+	"golang.org/x/sys/windows"
+)
+
+// watchResize polls the console width, since Windows has no SIGWINCH.
+func (s *Session) watchResize() {
+	s.updateWidth()
+
+	go func() {
+		for range time.Tick(time.Second) {
+			s.updateWidth()
+		}
+	}()
+}
+
+// notifyPause does nothing: Windows has no SIGUSR2, so pausing is only
+// possible through --control-file.
+func notifyPause(c chan<- os.Signal) {}
+
+// enableEscapes turns on virtual terminal processing for a console, which
+// Windows 10 and later need before they act on the escape sequences used
+// to redraw the progress line rather than printing them.
+func enableEscapes(f *os.File) {
+	h := windows.Handle(f.Fd())
+	var mode uint32
+	if err := windows.GetConsoleMode(h, &mode); err == nil {
+		_ = windows.SetConsoleMode(h, mode|windows.ENABLE_VIRTUAL_TERMINAL_PROCESSING)
+	}
+}
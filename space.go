@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// errWontFit is reported, before a file is opened, when it is bigger than
+// the free space left on its destination.
+var errWontFit = fmt.Errorf("%w: not enough free space for this file", syscall.ENOSPC)
+
+// usableSpace is freeSpace less the --reserve to keep free on path.
+func (s *Session) usableSpace(path string) (avail uint64, blockSize int64, err error) {
+	avail, total, blockSize, err := freeSpace(path)
+	if err != nil {
+		return 0, 0, err
+	}
+	reserve := s.args.Reserve.of(total)
+	if reserve >= avail {
+		return 0, blockSize, nil
+	}
+	return avail - reserve, blockSize, nil
+}
+
+// allocated rounds size up to whole blocks.
+func allocated(size, blockSize int64) int64 {
+	if blockSize <= 0 {
+		return size
+	}
+	return (size + blockSize - 1) / blockSize * blockSize
+}
+
+// fits reports whether dest has room for a copy of a file, counting only
+// the blocks a sparse file really uses and not the part already written
+// by an earlier --partial attempt. Clones onto the source's own
+// filesystem take no space and always fit.
+func (s *Session) fits(dest, dstRel string, info os.FileInfo) bool {
+	if !info.Mode().IsRegular() {
+		return true
+	}
+	avail, blockSize, err := s.usableSpace(dest)
+	if err != nil {
+		return true // let the copy itself fail
+	}
+	need := info.Size()
+	if used, ok := diskUsage(info); ok && s.args.Sparse != "never" {
+		need = min(need, used)
+	}
+	if dev, ok := fileDevice(info); ok && s.args.Reflink != "never" && onDevice(dest, dev) {
+		return true
+	}
+	if s.args.Partial {
+		if p, err := os.Stat(filepath.Join(dest, dstRel) + partialSuffix); err == nil {
+			need = max(need-p.Size(), 0)
+		}
+	}
+	return uint64(allocated(need, blockSize)) <= avail
+}
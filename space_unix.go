@@ -0,0 +1,30 @@
+//go:build unix
+
+package main
+
+import (
+	"errors"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// freeSpace returns the bytes available to unprivileged users on the
+// filesystem holding path (or its nearest existing parent), its total
+// size, and the filesystem block size.
+func freeSpace(path string) (avail, total uint64, blockSize int64, err error) {
+	dir, _, err := existingParent(path)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	var st unix.Statfs_t
+	if err := unix.Statfs(dir, &st); err != nil {
+		return 0, 0, 0, err
+	}
+	return uint64(st.Bavail) * uint64(st.Bsize), uint64(st.Blocks) * uint64(st.Bsize), int64(st.Bsize), nil
+}
+
+// isNoSpace reports whether err means the destination is full.
+func isNoSpace(err error) bool {
+	return errors.Is(err, syscall.ENOSPC)
+}
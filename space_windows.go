@@ -0,0 +1,58 @@
+package main
+
+import (
+	"errors"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+var procGetDiskFreeSpaceW = windows.NewLazySystemDLL("kernel32.dll").NewProc("GetDiskFreeSpaceW")
+
+// freeSpace returns the bytes available to the current user on the volume
+// holding path (or its nearest existing parent), counting disk quotas, its
+// total size, and the volume's cluster size.
+func freeSpace(path string) (avail, total uint64, blockSize int64, err error) {
+	dir, _, err := existingParent(path)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	p, err := pathPtr(dir)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	if err := windows.GetDiskFreeSpaceEx(p, &avail, &total, nil); err != nil {
+		return 0, 0, 0, err
+	}
+
+	var sectorsPerCluster, bytesPerSector, freeClusters, clusters uint32
+	if r, _, _ := procGetDiskFreeSpaceW.Call(uintptr(unsafe.Pointer(volumeRoot(dir))),
+		uintptr(unsafe.Pointer(&sectorsPerCluster)), uintptr(unsafe.Pointer(&bytesPerSector)),
+		uintptr(unsafe.Pointer(&freeClusters)), uintptr(unsafe.Pointer(&clusters))); r != 0 {
+		blockSize = int64(sectorsPerCluster) * int64(bytesPerSector)
+	}
+	return avail, total, blockSize, nil
+}
+
+// volumeRoot returns the root of the volume holding dir, such as C:\ or
+// \\server\share\, which is what GetDiskFreeSpace needs. It returns nil,
+// meaning the current volume, if that can't be found.
+func volumeRoot(dir string) *uint16 {
+	p, err := pathPtr(dir)
+	if err != nil {
+		return nil
+	}
+	buf := make([]uint16, windows.MAX_LONG_PATH)
+	if err := windows.GetVolumePathName(p, &buf[0], uint32(len(buf))); err != nil {
+		return nil
+	}
+	return &buf[0]
+}
+
+// isNoSpace reports whether err means the destination is full. Windows
+// reports a full disk as ERROR_DISK_FULL, or ERROR_HANDLE_DISK_FULL for
+// writes through a handle, never as ENOSPC.
+func isNoSpace(err error) bool {
+	return errors.Is(err, syscall.ENOSPC) || errors.Is(err, windows.ERROR_DISK_FULL) || errors.Is(err, windows.ERROR_HANDLE_DISK_FULL)
+}
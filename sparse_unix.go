@@ -0,0 +1,20 @@
+//go:build unix
+
+package main
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// nextData finds the first data segment of f at or after off with
+// SEEK_DATA and SEEK_HOLE. It fails with ENXIO if only a hole is left, and
+// with EINVAL if the filesystem can't tell holes apart.
+func nextData(f *os.File, off int64) (data, hole int64, err error) {
+	if data, err = f.Seek(off, unix.SEEK_DATA); err != nil {
+		return 0, 0, err
+	}
+	hole, err = f.Seek(data, unix.SEEK_HOLE)
+	return data, hole, err
+}
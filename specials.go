@@ -0,0 +1,88 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// specialMode covers the file types that can't be copied by reading them:
+// opening a FIFO blocks until something writes to it.
+const specialMode = fs.ModeNamedPipe | fs.ModeSocket | fs.ModeDevice | fs.ModeCharDevice
+
+var errSpecialFailed = errors.New("can't create special file")
+
+func specialKind(mode fs.FileMode) string {
+	switch {
+	case mode&fs.ModeNamedPipe != 0:
+		return "FIFO"
+	case mode&fs.ModeSocket != 0:
+		return "socket"
+	case mode&fs.ModeCharDevice != 0:
+		return "character device"
+	default:
+		return "block device"
+	}
+}
+
+// skipSpecial reports a special file found by the scan when --specials
+// isn't given.
+func (s *Session) skipSpecial(rel string, info fs.FileInfo) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.progress.SkippedSpecials++
+	fmt.Fprintf(s.out, "\r%s not copied: %s\033[K\n", specialKind(info.Mode()), rel)
+}
+
+// copySpecial recreates the FIFO, socket, or device node src at each of
+// dsts with mknod. Device nodes usually need root; like a destination
+// that can't hold them at all, that fails the file rather than the disk.
+func (s *Session) copySpecial(src string, dsts []string) (res copyResult, err error) {
+	sInfo, err := s.args.statSource(src)
+	if err != nil {
+		return res, err
+	}
+
+	for i, dst := range dsts {
+		if err := s.mkdirAll(filepath.Dir(dst)); err != nil {
+			return res, &destError{i, err}
+		}
+		_ = os.Remove(dst)
+		if err := mknod(dst, sInfo); err != nil {
+			if isNoSpace(err) {
+				return res, &destError{i, err}
+			}
+			return res, fmt.Errorf("%w: %s: %v", errSpecialFailed, dst, err)
+		}
+		if err := s.preserveMetadata(dst, sInfo); err != nil {
+			return res, &destError{i, err}
+		}
+	}
+	return res, nil
+}
+
+// compareSpecial checks that a special file was recreated with the same
+// type and device number. It reports false if src isn't a special file.
+func compareSpecial(src, dst string) (string, bool) {
+	sInfo, err := os.Stat(src)
+	if err != nil || sInfo.Mode()&specialMode == 0 {
+		return "", false
+	}
+	dInfo, err := os.Lstat(dst)
+	if os.IsNotExist(err) {
+		return "missing", true
+	} else if err != nil {
+		return err.Error(), true
+	}
+	if sInfo.Mode().Type() != dInfo.Mode().Type() {
+		return fmt.Sprintf("type mismatch (%s != %s)", sInfo.Mode().Type(), dInfo.Mode().Type()), true
+	}
+	sDev, ok1 := deviceNumber(sInfo)
+	dDev, ok2 := deviceNumber(dInfo)
+	if sInfo.Mode()&fs.ModeDevice != 0 && ok1 && ok2 && sDev != dDev {
+		return "device number mismatch", true
+	}
+	return "", true
+}
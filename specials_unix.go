@@ -0,0 +1,30 @@
+//go:build unix
+
+package main
+
+import (
+	"errors"
+	"os"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// mknod creates a special file at dst of the same type, permissions, and
+// device number as the one info describes.
+func mknod(dst string, info os.FileInfo) error {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return errors.ErrUnsupported
+	}
+	return unix.Mknod(dst, uint32(st.Mode), int(st.Rdev))
+}
+
+// deviceNumber returns the device a device node stands for.
+func deviceNumber(info os.FileInfo) (uint64, bool) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, false
+	}
+	return uint64(st.Rdev), true
+}
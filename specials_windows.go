@@ -0,0 +1,15 @@
+package main
+
+import (
+	"errors"
+	"os"
+)
+
+// mknod fails on Windows, which has no FIFOs or device nodes on disk.
+func mknod(dst string, info os.FileInfo) error {
+	return errors.ErrUnsupported
+}
+
+func deviceNumber(info os.FileInfo) (uint64, bool) {
+	return 0, false
+}
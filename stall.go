@@ -0,0 +1,78 @@
+package main
+
+import (
+	"errors"
+	"sync/atomic"
+	"time"
+)
+
+var errStalled = errors.New("no progress within --file-timeout, gave up on this file")
+
+// States of a stallWatch
+const (
+	watchActive int32 = iota
+	watchAbandoned
+	watchFinishing // the data is copied; what's left isn't watched
+)
+
+// stallWatch notices a copy that has stopped making progress, such as a
+// read from a hard-mounted NFS server that went away. A nil stallWatch
+// never stalls.
+type stallWatch struct {
+	last  atomic.Int64 // UnixNano of the last progress
+	state atomic.Int32
+}
+
+func (w *stallWatch) touch() {
+	if w != nil {
+		w.last.Store(time.Now().UnixNano())
+	}
+}
+
+func (w *stallWatch) abandoned() bool {
+	return w != nil && w.state.Load() == watchAbandoned
+}
+
+// finishing stops watching once the data is copied, since flushing and
+// verifying a large file don't report progress. It returns false if the
+// copy was already given up on.
+func (w *stallWatch) finishing() bool {
+	return w == nil || w.state.CompareAndSwap(watchActive, watchFinishing) || w.state.Load() == watchFinishing
+}
+
+// withFileTimeout runs copy, giving up on it once it has read nothing for
+// --file-timeout. A hung syscall can't be cancelled, so the abandoned copy
+// is left running; it fails with errStalled and cleans up after itself if
+// it ever returns.
+func (s *Session) withFileTimeout(copy func(*stallWatch) (copyResult, error)) (copyResult, error) {
+	timeout := s.args.FileTimeout
+	if timeout <= 0 {
+		return copy(nil)
+	}
+
+	type result struct {
+		res copyResult
+		err error
+	}
+	w := &stallWatch{}
+	w.touch()
+	done := make(chan result, 1)
+	go func() {
+		res, err := copy(w)
+		done <- result{res, err}
+	}()
+
+	tick := time.NewTicker(min(timeout/4, time.Second))
+	defer tick.Stop()
+	for {
+		select {
+		case r := <-done:
+			return r.res, r.err
+		case <-tick.C:
+			if time.Since(time.Unix(0, w.last.Load())) < timeout || !w.state.CompareAndSwap(watchActive, watchAbandoned) {
+				continue
+			}
+			return copyResult{}, errStalled
+		}
+	}
+}
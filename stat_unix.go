@@ -0,0 +1,50 @@
+//go:build unix
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// fileOwner returns the owner and group of a file.
+func fileOwner(info os.FileInfo) (uid, gid int, ok bool) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, 0, false
+	}
+	return int(st.Uid), int(st.Gid), true
+}
+
+// fileDevice returns the ID of the device holding a file.
+func fileDevice(info os.FileInfo) (uint64, bool) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, false
+	}
+	return uint64(st.Dev), true
+}
+
+// pathDevice returns the device ID of path, which info describes.
+func pathDevice(path string, info os.FileInfo) (uint64, bool) {
+	return fileDevice(info)
+}
+
+// fileInode returns a file's inode and how many links it has.
+func fileInode(info os.FileInfo) (id inode, nlink uint64, ok bool) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return inode{}, 0, false
+	}
+	return inode{uint64(st.Dev), uint64(st.Ino)}, uint64(st.Nlink), true
+}
+
+// diskUsage returns the bytes a file takes up on disk, which is less than
+// its size when it is sparse.
+func diskUsage(info os.FileInfo) (int64, bool) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, false
+	}
+	return st.Blocks * 512, true
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"os"
+
+	"golang.org/x/sys/windows"
+)
+
+// fileOwner isn't available on Windows, where owners are SIDs rather than
+// numeric IDs, so ownership is never copied.
+func fileOwner(info os.FileInfo) (uid, gid int, ok bool) {
+	return 0, 0, false
+}
+
+// fileDevice isn't available from a FileInfo on Windows; see pathDevice.
+func fileDevice(info os.FileInfo) (uint64, bool) {
+	return 0, false
+}
+
+// pathDevice returns the serial number of the volume holding path.
+func pathDevice(path string, info os.FileInfo) (uint64, bool) {
+	d, err := fileInformation(path)
+	if err != nil {
+		return 0, false
+	}
+	return uint64(d.VolumeSerialNumber), true
+}
+
+// fileInode isn't available from a FileInfo on Windows, so hard links in
+// the source are copied as separate files.
+func fileInode(info os.FileInfo) (id inode, nlink uint64, ok bool) {
+	return inode{}, 0, false
+}
+
+// diskUsage isn't available from a FileInfo on Windows; files are taken
+// to use their full size.
+func diskUsage(info os.FileInfo) (int64, bool) {
+	return 0, false
+}
+
+// fileInformation opens path, which may be a directory, without following
+// a final symlink and returns what GetFileInformationByHandle says about it.
+func fileInformation(path string) (*windows.ByHandleFileInformation, error) {
+	p, err := pathPtr(path)
+	if err != nil {
+		return nil, err
+	}
+	h, err := windows.CreateFile(p, 0, windows.FILE_SHARE_READ|windows.FILE_SHARE_WRITE|windows.FILE_SHARE_DELETE, nil,
+		windows.OPEN_EXISTING, windows.FILE_FLAG_BACKUP_SEMANTICS|windows.FILE_FLAG_OPEN_REPARSE_POINT, 0)
+	if err != nil {
+		return nil, &os.PathError{Op: "open", Path: path, Err: err}
+	}
+	defer windows.CloseHandle(h)
+	var d windows.ByHandleFileInformation
+	if err := windows.GetFileInformationByHandle(h, &d); err != nil {
+		return nil, &os.PathError{Op: "GetFileInformationByHandle", Path: path, Err: err}
+	}
+	return &d, nil
+}
@@ -0,0 +1,24 @@
+package main
+
+// copyStreams copies the named streams of src to dst. Streams the
+// destination filesystem can't hold are returned rather than treated as
+// an error.
+func copyStreams(src, dst string) (lost []string, err error) {
+	names, err := listStreams(src)
+	if err != nil {
+		if isUnsupported(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	for _, name := range names {
+		if err := copyStream(src, dst, name); err != nil {
+			if isUnsupported(err) {
+				lost = append(lost, name)
+				continue
+			}
+			return lost, err
+		}
+	}
+	return lost, nil
+}
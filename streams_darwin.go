@@ -0,0 +1,21 @@
+package main
+
+// On macOS the resource fork is exposed as an extended attribute.
+var streamAttrs = map[string]bool{
+	"com.apple.ResourceFork": true,
+}
+
+func listStreams(path string) ([]string, error) {
+	names, err := listXattrs(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var streams []string
+	for _, name := range names {
+		if streamAttrs[name] {
+			streams = append(streams, name)
+		}
+	}
+	return streams, nil
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// Linux has no native named streams. NTFS alternate data streams are only
+// visible through ntfs-3g mounted with streams_interface=xattr, where they
+// appear as user.* attributes, so those are copied when the source is on a
+// FUSE filesystem.
+func listStreams(path string) ([]string, error) {
+	var st unix.Statfs_t
+	if err := unix.Statfs(path, &st); err != nil {
+		return nil, err
+	}
+	if st.Type != unix.FUSE_SUPER_MAGIC {
+		return nil, nil
+	}
+
+	names, err := listXattrs(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var streams []string
+	for _, name := range names {
+		if strings.HasPrefix(name, "user.") {
+			streams = append(streams, name)
+		}
+	}
+	return streams, nil
+}
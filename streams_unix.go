@@ -0,0 +1,13 @@
+//go:build unix
+
+package main
+
+// copyStream copies one named stream, which Linux and macOS expose as an
+// extended attribute.
+func copyStream(src, dst, name string) error {
+	data, err := getXattr(src, name)
+	if err != nil {
+		return err
+	}
+	return setXattr(dst, name, data)
+}
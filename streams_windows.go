@@ -0,0 +1,90 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+var (
+	procFindFirstStreamW = windows.NewLazySystemDLL("kernel32.dll").NewProc("FindFirstStreamW")
+	procFindNextStreamW  = windows.NewLazySystemDLL("kernel32.dll").NewProc("FindNextStreamW")
+)
+
+// findStreamData is WIN32_FIND_STREAM_DATA.
+type findStreamData struct {
+	size int64
+	name [windows.MAX_PATH + 36]uint16
+}
+
+// listStreams returns the names of the NTFS alternate data streams of
+// path, such as Zone.Identifier, without the unnamed main stream.
+// Filesystems without streams report errors.ErrUnsupported.
+func listStreams(path string) ([]string, error) {
+	p, err := pathPtr(path)
+	if err != nil {
+		return nil, err
+	}
+	var data findStreamData
+	h, _, e := procFindFirstStreamW.Call(uintptr(unsafe.Pointer(p)), 0, uintptr(unsafe.Pointer(&data)), 0)
+	if windows.Handle(h) == windows.InvalidHandle {
+		switch {
+		case errors.Is(e, windows.ERROR_HANDLE_EOF):
+			return nil, nil
+		case errors.Is(e, windows.ERROR_INVALID_PARAMETER), errors.Is(e, windows.ERROR_NOT_SUPPORTED):
+			return nil, errors.ErrUnsupported
+		}
+		return nil, &os.PathError{Op: "FindFirstStream", Path: path, Err: e}
+	}
+	defer windows.FindClose(windows.Handle(h))
+
+	var names []string
+	for {
+		// Named data streams are listed as ":name:$DATA"
+		name, ok := strings.CutSuffix(windows.UTF16ToString(data.name[:]), ":$DATA")
+		if name = strings.TrimPrefix(name, ":"); ok && name != "" {
+			names = append(names, name)
+		}
+		if r, _, e := procFindNextStreamW.Call(h, uintptr(unsafe.Pointer(&data))); r == 0 {
+			if errors.Is(e, windows.ERROR_HANDLE_EOF) {
+				return names, nil
+			}
+			return names, &os.PathError{Op: "FindNextStream", Path: path, Err: e}
+		}
+	}
+}
+
+// copyStream copies the alternate data stream name of src to dst. It fails
+// with errors.ErrUnsupported if dst is on a filesystem without named
+// streams, such as FAT, exFAT, or most network shares.
+func copyStream(src, dst, name string) error {
+	if !namedStreams(dst) {
+		return errors.ErrUnsupported
+	}
+	in, err := os.Open(src + ":" + name)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst+":"+name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o666)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// namedStreams reports whether the volume holding path supports alternate
+// data streams.
+func namedStreams(path string) bool {
+	var flags uint32
+	err := windows.GetVolumeInformation(volumeRoot(path), nil, 0, nil, nil, &flags, nil, 0)
+	return err == nil && flags&windows.FILE_NAMED_STREAMS != 0
+}
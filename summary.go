@@ -0,0 +1,81 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// runSummary is the --summary-file report written when a run ends.
+type runSummary struct {
+	Status         string    `json:"status"` // ok, failed, or interrupted
+	Error          string    `json:"error,omitempty"`
+	FilesCopied    int64     `json:"files_copied"`
+	BytesCopied    int64     `json:"bytes_copied"`
+	FilesSkipped   int64     `json:"files_skipped"`
+	FilesRemaining int       `json:"files_remaining"`
+	RemainingList  string    `json:"remaining_list,omitempty"`
+	Errors         int64     `json:"errors"`
+	Started        time.Time `json:"started"`
+	Finished       time.Time `json:"finished"`
+	ElapsedSeconds float64   `json:"elapsed_seconds"`
+	Destinations   []string  `json:"destinations"`
+}
+
+// useDest records a destination in the order it was first written to.
+// The caller must hold s.mu.
+func (s *Session) useDest(dest string) {
+	if dest != "" {
+		s.usedDests = append(s.usedDests, dest)
+	}
+}
+
+// writeSummary writes --summary-file. remaining is the number of paths not
+// copied.
+func (s *Session) writeSummary(status string, runErr error, remaining int) {
+	if s.args.SummaryFile == "" {
+		return
+	}
+
+	s.mu.Lock()
+	now := time.Now()
+	sum := runSummary{
+		Status:         status,
+		FilesCopied:    s.progress.Global.Files,
+		BytesCopied:    s.progress.Global.Bytes,
+		FilesSkipped:   s.progress.Skipped.Files,
+		FilesRemaining: remaining,
+		RemainingList:  s.remainingList,
+		Errors:         s.progress.Errors,
+		Started:        s.began,
+		Finished:       now,
+		ElapsedSeconds: now.Sub(s.began).Seconds(),
+		Destinations:   append([]string{}, s.usedDests...),
+	}
+	s.mu.Unlock()
+	if runErr != nil {
+		sum.Error = runErr.Error()
+	}
+
+	data, err := json.MarshalIndent(sum, "", "  ")
+	if err == nil {
+		err = os.WriteFile(s.args.SummaryFile, append(data, '\n'), 0o644)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to write summary file: %v\n", err)
+	}
+}
+
+// remainingPaths returns the paths from startIndex on that weren't copied.
+func (s *Session) remainingPaths(startIndex int) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var remaining []string
+	for i := startIndex; i < len(s.allPaths); i++ {
+		if !s.done[i] {
+			remaining = append(remaining, s.allPaths[i])
+		}
+	}
+	return remaining
+}
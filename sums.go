@@ -0,0 +1,102 @@
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// writeSums appends a sha256sum-compatible line for every file copied to
+// dest since the last call to dest's SHA256SUMS (or XXH3SUMS or B3SUMS). Copies are claimed under
+// the lock, like verifyDisk, so a disk mounted at a path that was already
+// used only lists its own files. If the disk is too full to take the list,
+// it is saved in the working directory instead.
+func (s *Session) writeSums(dest string) {
+	if !s.args.Sums || dest == "" {
+		return
+	}
+
+	s.mu.Lock()
+	var lines []string
+	for i := range s.placed {
+		p := &s.placed[i]
+		switch {
+		case p.written == nil:
+			continue
+		case p.dest == dest && !p.destSummed:
+			p.destSummed = true
+		case p.mirror == dest && !p.mirrorSummed:
+			p.mirrorSummed = true
+		default:
+			continue
+		}
+		lines = append(lines, sumsLine(p.written, p.dstRel))
+	}
+	label := fmt.Sprintf("disk%d", s.progress.diskNum-1)
+	if dest == s.args.MirrorTo {
+		label = fmt.Sprintf("mirror%d", s.progress.mirrorDiskNum-1)
+	}
+	s.mu.Unlock()
+	if len(lines) == 0 {
+		return
+	}
+
+	name := filepath.Join(dest, s.hash.sumsFile)
+	err := appendLines(name, lines)
+	if err != nil {
+		fallback := fmt.Sprintf("%s.%s.%s", filepath.Base(s.args.Source), label, s.hash.sumsFile)
+		fmt.Fprintf(s.out, "\rfailed to write %s: %v\033[K\n", name, err)
+		if err := appendLines(fallback, lines); err != nil {
+			fmt.Fprintf(s.out, "failed to write %s: %v\n", fallback, err)
+			return
+		}
+		name = fallback
+	}
+	fmt.Fprintf(s.out, "\rChecksums of %d files saved to: %s\033[K\n", len(lines), name)
+}
+
+// sumsLine formats a line like sha256sum does, escaping backslashes and
+// newlines in the name and marking such lines with a leading backslash.
+func sumsLine(sum []byte, rel string) string {
+	name := filepath.ToSlash(rel)
+	prefix := ""
+	if strings.ContainsAny(name, "\\\n") {
+		prefix = `\`
+		name = strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(name)
+	}
+	return prefix + hex.EncodeToString(sum) + "  " + name
+}
+
+// appendLines adds lines to the end of name by writing a new copy and
+// renaming it over the old one, so a full disk can't leave a torn line.
+func appendLines(name string, lines []string) error {
+	data, err := os.ReadFile(name)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	data = append(data, strings.Join(lines, "\n")+"\n"...)
+
+	tmp := name + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, name)
+}
+
+// isSidecar reports whether rel is a checksum list, par2 file, or names
+// list that splitcopy added to the root of a destination.
+func isSidecar(rel string) bool {
+	if rel == namesFile {
+		return true
+	}
+	for _, alg := range hashAlgs {
+		if rel == alg.sumsFile {
+			return true
+		}
+	}
+	par2, _ := filepath.Match("splitcopy-*.par2", rel)
+	return par2
+}
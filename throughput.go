@@ -0,0 +1,48 @@
+package main
+
+import "time"
+
+// rateSpan is how far back the throughput estimate looks, long enough to
+// smooth over single files but short enough to follow a change from large
+// files to small ones.
+const rateSpan = 20 * time.Second
+
+type rateSample struct {
+	at    time.Time
+	bytes int64
+}
+
+// rateWindow estimates throughput as a moving average over the last
+// rateSpan of samples instead of over the whole run.
+type rateWindow struct {
+	samples []rateSample
+}
+
+// add records the total bytes copied at now, dropping samples that have
+// fallen out of the window. One older sample is kept as the baseline.
+func (w *rateWindow) add(now time.Time, bytes int64) {
+	w.samples = append(w.samples, rateSample{now, bytes})
+	i := 0
+	for i+1 < len(w.samples) && now.Sub(w.samples[i+1].at) >= rateSpan {
+		i++
+	}
+	w.samples = w.samples[i:]
+}
+
+// rate returns bytes per second over the window, or false until it covers
+// at least a second.
+func (w *rateWindow) rate() (float64, bool) {
+	if len(w.samples) < 2 {
+		return 0, false
+	}
+	first, last := w.samples[0], w.samples[len(w.samples)-1]
+	dt := last.at.Sub(first.at).Seconds()
+	if dt < 1 {
+		return 0, false
+	}
+	return float64(last.bytes-first.bytes) / dt, true
+}
+
+func (w *rateWindow) reset() {
+	w.samples = nil
+}
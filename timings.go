@@ -0,0 +1,87 @@
+package main
+
+import (
+	"container/heap"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+type fileTiming struct {
+	rel      string
+	size     int64
+	duration time.Duration
+}
+
+// timingHeap is a min-heap so the fastest of the current top N is evicted first
+type timingHeap []fileTiming
+
+func (h timingHeap) Len() int           { return len(h) }
+func (h timingHeap) Less(i, j int) bool { return h[i].duration < h[j].duration }
+func (h timingHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *timingHeap) Push(x any)        { *h = append(*h, x.(fileTiming)) }
+func (h *timingHeap) Pop() any {
+	old := *h
+	t := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return t
+}
+
+type Timings struct {
+	limit   int
+	slowest timingHeap
+	dirs    map[string]*fileTiming
+}
+
+func newTimings(limit int) *Timings {
+	return &Timings{limit: limit, dirs: make(map[string]*fileTiming)}
+}
+
+func (t *Timings) record(rel string, size int64, d time.Duration) {
+	if t.limit <= 0 {
+		return
+	}
+
+	heap.Push(&t.slowest, fileTiming{rel, size, d})
+	if t.slowest.Len() > t.limit {
+		heap.Pop(&t.slowest)
+	}
+
+	dir := filepath.Dir(rel)
+	dt, ok := t.dirs[dir]
+	if !ok {
+		dt = &fileTiming{rel: dir}
+		t.dirs[dir] = dt
+	}
+	dt.size += size
+	dt.duration += d
+}
+
+func (t *Timings) print(w io.Writer) {
+	if t.limit <= 0 || t.slowest.Len() == 0 {
+		return
+	}
+
+	files := append([]fileTiming(nil), t.slowest...)
+	sort.Slice(files, func(i, j int) bool { return files[i].duration > files[j].duration })
+
+	dirs := make([]fileTiming, 0, len(t.dirs))
+	for _, dt := range t.dirs {
+		dirs = append(dirs, *dt)
+	}
+	sort.Slice(dirs, func(i, j int) bool { return dirs[i].duration > dirs[j].duration })
+	if len(dirs) > t.limit {
+		dirs = dirs[:t.limit]
+	}
+
+	fmt.Fprintln(w, "Slowest files:")
+	for _, ft := range files {
+		fmt.Fprintf(w, "  %8s  %10s  %s\n", ft.duration.Round(time.Millisecond), humanBytes(ft.size), ft.rel)
+	}
+	fmt.Fprintln(w, "Slowest directories:")
+	for _, dt := range dirs {
+		fmt.Fprintf(w, "  %8s  %10s  %s\n", dt.duration.Round(time.Millisecond), humanBytes(dt.size), dt.rel)
+	}
+}
@@ -0,0 +1,17 @@
+package main
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+)
+
+// openTmpfile isn't available on macOS, which has no O_TMPFILE; files are
+// created under their temporary name instead.
+func openTmpfile(dir, name string, perm fs.FileMode) (*os.File, error) {
+	return nil, errors.ErrUnsupported
+}
+
+func linkTmpfile(f *os.File, name string) error {
+	return errors.ErrUnsupported
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"strconv"
+
+	"golang.org/x/sys/unix"
+)
+
+// openTmpfile creates an unnamed file in dir with O_TMPFILE, which only
+// appears in the tree once linkTmpfile gives it a name, so not even a
+// crash can leave it behind half written. name is used in error messages.
+func openTmpfile(dir, name string, perm fs.FileMode) (*os.File, error) {
+	// Naming the file later goes through /proc
+	if _, err := os.Stat("/proc/self/fd"); err != nil {
+		return nil, err
+	}
+	fd, err := unix.Open(dir, unix.O_TMPFILE|unix.O_WRONLY|unix.O_CLOEXEC, uint32(perm))
+	if err != nil {
+		return nil, &os.PathError{Op: "open", Path: dir, Err: err}
+	}
+	return os.NewFile(uintptr(fd), name), nil
+}
+
+// linkTmpfile gives a file from openTmpfile its name, replacing a file
+// left there by an earlier run.
+func linkTmpfile(f *os.File, name string) error {
+	proc := "/proc/self/fd/" + strconv.Itoa(int(f.Fd()))
+	err := unix.Linkat(unix.AT_FDCWD, proc, unix.AT_FDCWD, name, unix.AT_SYMLINK_FOLLOW)
+	if errors.Is(err, unix.EEXIST) {
+		_ = os.Remove(name)
+		err = unix.Linkat(unix.AT_FDCWD, proc, unix.AT_FDCWD, name, unix.AT_SYMLINK_FOLLOW)
+	}
+	if err != nil {
+		return &os.PathError{Op: "link", Path: name, Err: err}
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// mountPoint returns the top directory of the filesystem holding path.
+func mountPoint(path string) (string, error) {
+	dev, err := deviceOf(path)
+	if err != nil {
+		return "", err
+	}
+	dir := filepath.Dir(path)
+	for {
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return dir, nil
+		}
+		if d, err := deviceOf(parent); err != nil || d != dev {
+			return dir, nil
+		}
+		dir = parent
+	}
+}
+
+// trashName returns base for the first try and base.N after that, so
+// repeated deletions of the same name don't overwrite each other.
+func trashName(base string, try int) string {
+	if try == 1 {
+		return base
+	}
+	return fmt.Sprintf("%s.%d", base, try)
+}
+
+// onDevice reports whether dir, or its nearest existing parent, is on dev.
+func onDevice(dir string, dev uint64) bool {
+	d, err := deviceOf(dir)
+	return err == nil && d == dev
+}
+
+// isTrashDir reports whether rel is a trash directory at the top of a
+// filesystem, so moving sources there doesn't feed them back into the scan
+// when the source is a mount point.
+func isTrashDir(rel string) bool {
+	return rel == ".Trash" || rel == ".Trashes" || strings.HasPrefix(rel, ".Trash-")
+}
+
+func mkdirPrivate(dirs ...string) error {
+	for _, dir := range dirs {
+		if err := os.MkdirAll(dir, 0o700); err != nil {
+			return err
+		}
+	}
+	return nil
+}
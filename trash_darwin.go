@@ -0,0 +1,47 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// moveToTrash moves path to ~/.Trash if it is on the startup volume, or to
+// the volume's .Trashes/$uid otherwise, like the Finder does.
+func moveToTrash(path string) error {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	dev, err := deviceOf(path)
+	if err != nil {
+		return err
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return err
+	}
+	trash := filepath.Join(home, ".Trash")
+	if !onDevice(home, dev) {
+		top, err := mountPoint(path)
+		if err != nil {
+			return err
+		}
+		trash = filepath.Join(top, ".Trashes", strconv.Itoa(os.Getuid()))
+	}
+	if err := mkdirPrivate(trash); err != nil {
+		return err
+	}
+
+	for try := 1; ; try++ {
+		dst := filepath.Join(trash, trashName(filepath.Base(path), try))
+		if _, err := os.Lstat(dst); err == nil {
+			continue
+		} else if !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		return os.Rename(path, dst)
+	}
+}
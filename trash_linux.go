@@ -0,0 +1,87 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// moveToTrash moves path to the freedesktop.org trash: the home trash if
+// path is on the same filesystem, otherwise a per-user trash at the top of
+// the filesystem holding it, so the move never copies data.
+func moveToTrash(path string) error {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	dev, err := deviceOf(path)
+	if err != nil {
+		return err
+	}
+
+	dataHome := os.Getenv("XDG_DATA_HOME")
+	if dataHome == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return err
+		}
+		dataHome = filepath.Join(home, ".local", "share")
+	}
+
+	trash := filepath.Join(dataHome, "Trash")
+	origin := path
+	if !onDevice(dataHome, dev) {
+		top, err := mountPoint(path)
+		if err != nil {
+			return err
+		}
+		trash = topTrash(top)
+		origin, _ = filepath.Rel(top, path)
+	}
+	files, info := filepath.Join(trash, "files"), filepath.Join(trash, "info")
+	if err := mkdirPrivate(files, info); err != nil {
+		return err
+	}
+
+	// Claim a name by creating its .trashinfo exclusively, as the spec asks
+	for try := 1; ; try++ {
+		name := trashName(filepath.Base(path), try)
+		infoPath := filepath.Join(info, name+".trashinfo")
+		f, err := os.OpenFile(infoPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+		if errors.Is(err, os.ErrExist) {
+			continue
+		} else if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(f, "[Trash Info]\nPath=%s\nDeletionDate=%s\n",
+			(&url.URL{Path: origin}).EscapedPath(), time.Now().Format("2006-01-02T15:04:05"))
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err == nil {
+			err = os.Rename(path, filepath.Join(files, name))
+		}
+		if err != nil {
+			os.Remove(infoPath)
+		}
+		return err
+	}
+}
+
+// topTrash returns $topdir/.Trash/$uid if the administrator has set up a
+// sticky, non-symlink .Trash directory, and $topdir/.Trash-$uid otherwise.
+func topTrash(top string) string {
+	uid := strconv.Itoa(os.Getuid())
+	shared := filepath.Join(top, ".Trash")
+	if info, err := os.Lstat(shared); err == nil && info.IsDir() && info.Mode()&os.ModeSticky != 0 {
+		dir := filepath.Join(shared, uid)
+		if mkdirPrivate(dir) == nil {
+			return dir
+		}
+	}
+	return filepath.Join(top, ".Trash-"+uid)
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+var procSHFileOperationW = windows.NewLazySystemDLL("shell32.dll").NewProc("SHFileOperationW")
+
+// From shellapi.h
+const (
+	foDelete          = 0x3
+	fofSilent         = 0x4
+	fofNoConfirmation = 0x10
+	fofAllowUndo      = 0x40
+	fofNoErrorUI      = 0x400
+)
+
+type shFileOpStruct struct {
+	hwnd                  uintptr
+	wFunc                 uint32
+	pFrom                 *uint16
+	pTo                   *uint16
+	fFlags                uint16
+	fAnyOperationsAborted int32
+	hNameMappings         uintptr
+	lpszProgressTitle     *uint16
+}
+
+// moveToTrash moves path to the Recycle Bin, like deleting it in Explorer.
+// Drives without a Recycle Bin, such as network shares, delete it instead.
+// The shell only takes paths up to MAX_PATH.
+func moveToTrash(path string) error {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	if len(path) >= maxShortPath {
+		return fmt.Errorf("%s: path too long for the Recycle Bin", path)
+	}
+	// pFrom is a list of names ending with an empty one
+	from, err := windows.UTF16FromString(path)
+	if err != nil {
+		return err
+	}
+	op := shFileOpStruct{
+		wFunc:  foDelete,
+		pFrom:  &append(from, 0)[0],
+		fFlags: fofAllowUndo | fofNoConfirmation | fofNoErrorUI | fofSilent,
+	}
+	if r, _, _ := procSHFileOperationW.Call(uintptr(unsafe.Pointer(&op))); r != 0 {
+		return fmt.Errorf("moving %s to the Recycle Bin: SHFileOperation failed with code %#x", path, r)
+	}
+	return nil
+}
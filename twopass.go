@@ -0,0 +1,94 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// createPlaceholders is the first pass of --two-pass: it lays out every
+// directory and an empty placeholder for each file, with the source mode
+// and times, so the destination tree is browsable before any content is
+// written. Placeholders are always empty, so a size comparison never
+// mistakes one for a finished copy, and files that haven't been filled in
+// yet stay in the remaining-files list when interrupted.
+func (s *Session) createPlaceholders(startIndex int) error {
+	var created int
+	for i := startIndex; ; i++ {
+		rel, more, err := s.waitPath(i, s.stopCh)
+		if errors.Is(err, errInterrupted) {
+			return err
+		} else if !more {
+			break
+		}
+		if len(s.sigIntChan) > 0 {
+			s.stop()
+			return errInterrupted
+		}
+
+		sInfo, err := os.Stat(filepath.Join(s.args.Source, rel))
+		if err != nil {
+			continue // reported by the copy pass
+		}
+
+		for _, dest := range []string{s.args.Destination, s.args.MirrorTo} {
+			if dest == "" {
+				continue
+			}
+			dst := filepath.Join(dest, s.args.destName(rel)+s.args.PipeSuffix)
+			ok, err := s.createPlaceholder(dst, sInfo)
+			if err != nil {
+				return fmt.Errorf("placeholders: %w", err)
+			}
+			if ok {
+				created++
+				s.mu.Lock()
+				s.placeholders[dst] = i
+				s.mu.Unlock()
+			}
+		}
+	}
+
+	fmt.Fprintf(s.out, "Created %d placeholders\n", created)
+	return nil
+}
+
+// createPlaceholder never touches an existing file since it may already
+// hold complete content from an earlier run.
+func (s *Session) createPlaceholder(dst string, sInfo os.FileInfo) (bool, error) {
+	if err := s.mkdirAll(filepath.Dir(dst)); err != nil {
+		return false, err
+	}
+
+	f, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, s.fileMode(sInfo.Mode()).Perm())
+	if errors.Is(err, os.ErrExist) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	if err := f.Close(); err != nil {
+		return false, err
+	}
+	return true, s.preserveMetadata(dst, sInfo)
+}
+
+// removePlaceholders deletes the placeholders on dest that were never
+// filled in, before it is swapped out. Their files are copied to the next
+// disk instead, and an empty file with the source mtime left behind could
+// pass for an up-to-date copy on a later run.
+func (s *Session) removePlaceholders(dest string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for dst, i := range s.placeholders {
+		if !within(dst, dest) {
+			continue
+		}
+		if !s.done[i] {
+			if err := os.Remove(dst); err != nil && !os.IsNotExist(err) {
+				fmt.Fprintf(s.out, "\r%v\033[K\n", err)
+			}
+		}
+		delete(s.placeholders, dst)
+	}
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alecthomas/kong"
+)
+
+// ByteSize is a flag value accepting human units. Single letters and the
+// IEC forms are binary (10M, 2GiB); the SI forms are decimal (4TB).
+type ByteSize int64
+
+func (b *ByteSize) Decode(ctx *kong.DecodeContext) error {
+	var value string
+	if err := ctx.Scan.PopValueInto("size", &value); err != nil {
+		return err
+	}
+	n, err := parseBytes(value)
+	if err != nil {
+		return err
+	}
+	*b = ByteSize(n)
+	return nil
+}
+
+func parseBytes(s string) (int64, error) {
+	s = strings.TrimSpace(s)
+	i := strings.IndexFunc(s, func(r rune) bool {
+		return (r < '0' || r > '9') && r != '.'
+	})
+	num, unit := s, ""
+	if i >= 0 {
+		num, unit = s[:i], strings.TrimSpace(s[i:])
+	}
+
+	f, err := strconv.ParseFloat(num, 64)
+	if err != nil || f < 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+
+	mult, ok := byteUnits[strings.ToUpper(unit)]
+	if !ok {
+		return 0, fmt.Errorf("invalid size unit %q", unit)
+	}
+	return int64(f * float64(mult)), nil
+}
+
+var byteUnits = map[string]int64{
+	"": 1, "B": 1,
+	"K": 1 << 10, "KIB": 1 << 10, "KB": 1e3,
+	"M": 1 << 20, "MIB": 1 << 20, "MB": 1e6,
+	"G": 1 << 30, "GIB": 1 << 30, "GB": 1e9,
+	"T": 1 << 40, "TIB": 1 << 40, "TB": 1e12,
+	"P": 1 << 50, "PIB": 1 << 50, "PB": 1e15,
+}
+
+// TimeBound is a point in time given either as a date ("2024-05-01",
+// RFC 3339) or as an age relative to now ("30d", "12h", "1y2w").
+type TimeBound struct {
+	time.Time
+}
+
+func (t *TimeBound) Decode(ctx *kong.DecodeContext) error {
+	var value string
+	if err := ctx.Scan.PopValueInto("time", &value); err != nil {
+		return err
+	}
+	parsed, err := parseTimeBound(value, time.Now())
+	if err != nil {
+		return err
+	}
+	t.Time = parsed
+	return nil
+}
+
+var ageUnits = map[byte]time.Duration{
+	's': time.Second,
+	'm': time.Minute,
+	'h': time.Hour,
+	'd': 24 * time.Hour,
+	'w': 7 * 24 * time.Hour,
+	'y': 365 * 24 * time.Hour,
+}
+
+var timeLayouts = []string{time.RFC3339Nano, "2006-01-02T15:04:05", "2006-01-02 15:04:05", "2006-01-02 15:04", "2006-01-02"}
+
+func parseTimeBound(s string, now time.Time) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	for _, layout := range timeLayouts {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, nil
+		}
+	}
+
+	if s == "" {
+		return time.Time{}, fmt.Errorf("invalid time or age %q", s)
+	}
+	var age time.Duration
+	rest := s
+	for rest != "" {
+		i := strings.IndexFunc(rest, func(r rune) bool {
+			return (r < '0' || r > '9') && r != '.'
+		})
+		if i <= 0 {
+			return time.Time{}, fmt.Errorf("invalid time or age %q", s)
+		}
+		unit, ok := ageUnits[rest[i]]
+		if !ok {
+			return time.Time{}, fmt.Errorf("invalid age unit %q in %q", rest[i], s)
+		}
+		f, err := strconv.ParseFloat(rest[:i], 64)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid time or age %q", s)
+		}
+		age += time.Duration(f * float64(unit))
+		rest = rest[i+1:]
+	}
+	return now.Add(-age), nil
+}
+
+// Percent is a whole percentage, written with or without the % sign.
+type Percent int
+
+func (p *Percent) Decode(ctx *kong.DecodeContext) error {
+	var value string
+	if err := ctx.Scan.PopValueInto("percent", &value); err != nil {
+		return err
+	}
+	n, err := strconv.Atoi(strings.TrimSuffix(strings.TrimSpace(value), "%"))
+	if err != nil || n < 1 || n > 100 {
+		return fmt.Errorf("invalid percentage %q (want 1%% to 100%%)", value)
+	}
+	*p = Percent(n)
+	return nil
+}
+
+// Reserve is an amount of space to leave free on each destination, given
+// as a size (20G) or as a percentage of the filesystem (5%).
+type Reserve struct {
+	Bytes   int64
+	Percent float64
+}
+
+func (r *Reserve) Decode(ctx *kong.DecodeContext) error {
+	var value string
+	if err := ctx.Scan.PopValueInto("size", &value); err != nil {
+		return err
+	}
+	if pct, ok := strings.CutSuffix(strings.TrimSpace(value), "%"); ok {
+		f, err := strconv.ParseFloat(pct, 64)
+		if err != nil || f < 0 || f >= 100 {
+			return fmt.Errorf("invalid percentage %q (want 0%% to 99%%)", value)
+		}
+		*r = Reserve{Percent: f}
+		return nil
+	}
+	n, err := parseBytes(value)
+	if err != nil {
+		return err
+	}
+	*r = Reserve{Bytes: n}
+	return nil
+}
+
+// of returns the bytes to keep free on a filesystem of the given size.
+func (r Reserve) of(total uint64) uint64 {
+	if r.Percent > 0 {
+		return uint64(float64(total) * r.Percent / 100)
+	}
+	return uint64(r.Bytes)
+}
@@ -0,0 +1,36 @@
+package main
+
+import "testing"
+
+func TestParseBytes(t *testing.T) {
+	tests := []struct {
+		in   string
+		want int64
+	}{
+		{"0", 0},
+		{"512", 512},
+		{"512B", 512},
+		{"10K", 10 << 10},
+		{"10k", 10 << 10},
+		{"10KiB", 10 << 10},
+		{"10KB", 10_000},
+		{"1.5M", 3 << 19},
+		{"2GiB", 2 << 30},
+		{"4TB", 4e12},
+		{"2.5TiB", 5 << 39},
+		{" 1 G ", 1 << 30},
+		{"1P", 1 << 50},
+	}
+	for _, tt := range tests {
+		got, err := parseBytes(tt.in)
+		if err != nil || got != tt.want {
+			t.Errorf("parseBytes(%q) = %d, %v; want %d", tt.in, got, err, tt.want)
+		}
+	}
+
+	for _, in := range []string{"", "G", "-1G", "1X", "1.2.3M", "10 KiBs"} {
+		if got, err := parseBytes(in); err == nil {
+			t.Errorf("parseBytes(%q) = %d, want an error", in, got)
+		}
+	}
+}
@@ -0,0 +1,362 @@
+package main
+
+import (
+	"io"
+	"os"
+	"sync/atomic"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// From linux/io_uring.h
+const (
+	uringOpRead  = 22
+	uringOpWrite = 23
+
+	uringEnterGetEvents = 1
+	uringFeatSingleMmap = 1
+
+	uringOffSQRing = 0
+	uringOffCQRing = 0x8000000
+	uringOffSQEs   = 0x10000000
+)
+
+const (
+	uringEntries = 64
+	uringDepth   = 8 // buffers in flight per copy
+)
+
+type uringParams struct {
+	sqEntries, cqEntries, flags, sqThreadCPU, sqThreadIdle, features, wqFd uint32
+	resv                                                                   [3]uint32
+	sqOff                                                                  uringSQOffsets
+	cqOff                                                                  uringCQOffsets
+}
+
+type uringSQOffsets struct {
+	head, tail, ringMask, ringEntries, flags, dropped, array, resv1 uint32
+	userAddr                                                        uint64
+}
+
+type uringCQOffsets struct {
+	head, tail, ringMask, ringEntries, overflow, cqes, flags, resv1 uint32
+	userAddr                                                        uint64
+}
+
+type uringSQE struct {
+	opcode      uint8
+	flags       uint8
+	ioprio      uint16
+	fd          int32
+	off         uint64
+	addr        uint64
+	len         uint32
+	rwFlags     uint32
+	userData    uint64
+	bufIndex    uint16
+	personality uint16
+	spliceFdIn  int32
+	addr3       uint64
+	pad         uint64
+}
+
+type uringCQE struct {
+	userData uint64
+	res      int32
+	flags    uint32
+}
+
+// uring is an io_uring instance and its buffers. Rings are kept in
+// uringPool between copies, since setting one up costs several syscalls.
+type uring struct {
+	fd                     int
+	sqRing, cqRing, sqeMem []byte
+	sqTail, sqMask         *uint32
+	cqHead, cqTail, cqMask *uint32
+	sqes                   []uringSQE
+	cqes                   []uringCQE
+	bufs                   [][]byte
+	queued                 uint32 // SQEs not yet submitted
+	broken                 bool   // requests may still be in flight
+}
+
+var uringPool = make(chan *uring, 64)
+
+// probeUring reports why io_uring can't be used, if it can't: kernels
+// before 5.6, seccomp filters, or kernel.io_uring_disabled.
+func probeUring() error {
+	u, err := newUring(directAlign)
+	if err != nil {
+		return err
+	}
+	u.close()
+	return nil
+}
+
+func newUring(bufSize int) (*uring, error) {
+	var p uringParams
+	fd, _, errno := unix.Syscall(unix.SYS_IO_URING_SETUP, uringEntries, uintptr(unsafe.Pointer(&p)), 0)
+	if errno != 0 {
+		return nil, &os.SyscallError{Syscall: "io_uring_setup", Err: errno}
+	}
+	u := &uring{fd: int(fd)}
+
+	sqSize := int(p.sqOff.array + p.sqEntries*4)
+	cqSize := int(p.cqOff.cqes + p.cqEntries*uint32(unsafe.Sizeof(uringCQE{})))
+	single := p.features&uringFeatSingleMmap != 0
+	if single {
+		sqSize = max(sqSize, cqSize)
+	}
+	prot, flags := unix.PROT_READ|unix.PROT_WRITE, unix.MAP_SHARED|unix.MAP_POPULATE
+	var err error
+	if u.sqRing, err = unix.Mmap(u.fd, uringOffSQRing, sqSize, prot, flags); err != nil {
+		u.close()
+		return nil, err
+	}
+	u.cqRing = u.sqRing
+	if !single {
+		if u.cqRing, err = unix.Mmap(u.fd, uringOffCQRing, cqSize, prot, flags); err != nil {
+			u.close()
+			return nil, err
+		}
+	}
+	if u.sqeMem, err = unix.Mmap(u.fd, uringOffSQEs, int(p.sqEntries)*int(unsafe.Sizeof(uringSQE{})), prot, flags); err != nil {
+		u.close()
+		return nil, err
+	}
+
+	u.sqTail = ringWord(u.sqRing, p.sqOff.tail)
+	u.sqMask = ringWord(u.sqRing, p.sqOff.ringMask)
+	u.cqHead = ringWord(u.cqRing, p.cqOff.head)
+	u.cqTail = ringWord(u.cqRing, p.cqOff.tail)
+	u.cqMask = ringWord(u.cqRing, p.cqOff.ringMask)
+	array := unsafe.Slice(ringWord(u.sqRing, p.sqOff.array), p.sqEntries)
+	for i := range array {
+		array[i] = uint32(i)
+	}
+	u.sqes = unsafe.Slice((*uringSQE)(unsafe.Pointer(&u.sqeMem[0])), p.sqEntries)
+	u.cqes = unsafe.Slice((*uringCQE)(unsafe.Pointer(&u.cqRing[p.cqOff.cqes])), p.cqEntries)
+
+	// Outside the Go heap, so the kernel can fill them while Go code runs
+	for range uringDepth {
+		buf, err := unix.Mmap(-1, 0, bufSize, prot, unix.MAP_PRIVATE|unix.MAP_ANONYMOUS)
+		if err != nil {
+			u.close()
+			return nil, err
+		}
+		u.bufs = append(u.bufs, buf)
+	}
+	return u, nil
+}
+
+func ringWord(mem []byte, off uint32) *uint32 {
+	return (*uint32)(unsafe.Pointer(&mem[off]))
+}
+
+func (u *uring) close() {
+	for _, buf := range u.bufs {
+		_ = unix.Munmap(buf)
+	}
+	if u.sqeMem != nil {
+		_ = unix.Munmap(u.sqeMem)
+	}
+	if u.cqRing != nil && &u.cqRing[0] != &u.sqRing[0] {
+		_ = unix.Munmap(u.cqRing)
+	}
+	if u.sqRing != nil {
+		_ = unix.Munmap(u.sqRing)
+	}
+	unix.Close(u.fd)
+}
+
+// push queues e. Callers keep fewer requests in flight than the ring has
+// entries, so there is always room.
+func (u *uring) push(e uringSQE) {
+	tail := *u.sqTail
+	u.sqes[tail&*u.sqMask] = e
+	atomic.StoreUint32(u.sqTail, tail+1)
+	u.queued++
+}
+
+// enter submits the queued requests and waits for at least one to complete.
+func (u *uring) enter() error {
+	for {
+		n, _, errno := unix.Syscall6(unix.SYS_IO_URING_ENTER, uintptr(u.fd), uintptr(u.queued), 1, uringEnterGetEvents, 0, 0)
+		if errno == syscall.EINTR {
+			continue
+		} else if errno != 0 {
+			return &os.SyscallError{Syscall: "io_uring_enter", Err: errno}
+		}
+		u.queued -= uint32(n)
+		return nil
+	}
+}
+
+func (u *uring) reap(fn func(uringCQE)) {
+	head := *u.cqHead
+	for tail := atomic.LoadUint32(u.cqTail); head != tail; head++ {
+		fn(u.cqes[head&*u.cqMask])
+	}
+	atomic.StoreUint32(u.cqHead, head)
+}
+
+// uringBlock is one buffer's worth of the file on its way through the ring.
+type uringBlock struct {
+	off     int64
+	want    int   // bytes of the file in this block
+	got     int   // read so far
+	read    bool  // all of want is in the buffer
+	writes  int   // writes in flight
+	written []int // per destination
+}
+
+// copyUring copies size bytes of in to outs through an io_uring: up to
+// uringDepth buffers are read and written at once, each destination at the
+// block's own offset, and every batch of requests costs one syscall. The
+// blocks are fed to sum in order.
+func (s *Session) copyUring(in *os.File, outs []destFile, r *interruptReader, sum io.Writer, size int64) error {
+	bufSize := s.bufferSize
+	if bufSize == 0 {
+		bufSize = defaultBufferSize
+	}
+	var u *uring
+	select {
+	case u = <-uringPool:
+		if len(u.bufs[0]) != bufSize {
+			u.close()
+			u = nil
+		}
+	default:
+	}
+	if u == nil {
+		var err error
+		if u, err = newUring(bufSize); err != nil {
+			return err
+		}
+	}
+	defer func() {
+		if !u.broken {
+			select {
+			case uringPool <- u:
+				return
+			default:
+			}
+		}
+		u.close()
+	}()
+
+	bs := int64(bufSize)
+	depth := int64(min(len(u.bufs), uringEntries/(1+len(outs))))
+	blocks := make([]uringBlock, depth)
+	count := (size + bs - 1) / bs
+	var next, hashed, retired int64 // block numbers
+	var inflight int
+	var err error
+	fail := func(e error) {
+		if err == nil {
+			err = e
+		}
+	}
+	write := func(slot int64, i int) {
+		b := &blocks[slot]
+		buf := u.bufs[slot][b.written[i]:b.got]
+		u.push(uringSQE{opcode: uringOpWrite, fd: int32(outs[i].Fd()), off: uint64(b.off) + uint64(b.written[i]),
+			addr: uint64(uintptr(unsafe.Pointer(&buf[0]))), len: uint32(len(buf)), userData: uint64(slot)<<8 | uint64(1+i)})
+		inflight++
+	}
+	read := func(slot int64) {
+		b := &blocks[slot]
+		buf := u.bufs[slot][b.got:b.want]
+		u.push(uringSQE{opcode: uringOpRead, fd: int32(in.Fd()), off: uint64(b.off) + uint64(b.got),
+			addr: uint64(uintptr(unsafe.Pointer(&buf[0]))), len: uint32(len(buf)), userData: uint64(slot) << 8})
+		inflight++
+	}
+
+	for {
+		for err == nil && next < count && next-retired < depth {
+			if r.stop.Load() {
+				fail(errInterrupted)
+				break
+			} else if r.watch.abandoned() {
+				fail(errStalled)
+				break
+			}
+			slot := next % depth
+			blocks[slot] = uringBlock{off: next * bs, want: int(min(bs, size-next*bs)), written: make([]int, len(outs))}
+			read(slot)
+			next++
+		}
+		if inflight == 0 {
+			break
+		}
+		// After an error, wait for what is in flight so the ring is clean
+		if e := u.enter(); e != nil {
+			u.broken = true
+			fail(e)
+			return err
+		}
+
+		u.reap(func(c uringCQE) {
+			inflight--
+			slot, op := int64(c.userData>>8), int(c.userData&0xff)
+			b := &blocks[slot]
+			if op == 0 {
+				switch {
+				case c.res < 0:
+					fail(&os.PathError{Op: "read", Path: in.Name(), Err: syscall.Errno(-c.res)})
+					return
+				case c.res == 0:
+					fail(io.ErrUnexpectedEOF) // the source shrank
+					return
+				}
+				b.got += int(c.res)
+				r.n += int64(c.res)
+				r.count.Add(int64(c.res))
+				r.watch.touch()
+				r.nocache.copied(int64(c.res))
+				if !r.limit.wait(int64(c.res), r.stop) {
+					fail(errInterrupted)
+				}
+				if err != nil {
+					return
+				}
+				if b.got < b.want {
+					read(slot)
+					return
+				}
+				b.read = true
+				for i := range outs {
+					b.writes++
+					write(slot, i)
+				}
+				return
+			}
+
+			i := op - 1
+			if c.res < 0 {
+				b.writes--
+				fail(&destError{outs[i].dest, &os.PathError{Op: "write", Path: outs[i].Name(), Err: syscall.Errno(-c.res)}})
+				return
+			}
+			b.written[i] += int(c.res)
+			if b.written[i] < b.got && err == nil {
+				write(slot, i)
+				return
+			}
+			b.writes--
+		})
+
+		for ; hashed < next && blocks[hashed%depth].read; hashed++ {
+			if sum != nil {
+				b := &blocks[hashed%depth]
+				sum.Write(u.bufs[hashed%depth][:b.got])
+			}
+		}
+		for retired < hashed && blocks[retired%depth].writes == 0 {
+			retired++
+		}
+	}
+	return err
+}
@@ -0,0 +1,16 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"os"
+)
+
+// probeUring fails on Windows, which has no io_uring.
+func probeUring() error {
+	return errors.ErrUnsupported
+}
+
+func (s *Session) copyUring(in *os.File, outs []destFile, r *interruptReader, sum io.Writer, size int64) error {
+	return errors.ErrUnsupported
+}
@@ -0,0 +1,511 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// placement records where a scanned source path ended up. An empty dest
+// means the file was never written anywhere.
+type placement struct {
+	rel    string
+	dstRel string
+	dest   string
+	mirror string
+	sum    []byte // expected destination hash when the content was transformed
+
+	// set once a per-disk verify pass has claimed the copy on dest or mirror
+	destChecked   bool
+	mirrorChecked bool
+
+	written      []byte // hash of the written bytes for --sums
+	destSummed   bool
+	mirrorSummed bool
+	destNamed    bool // listed in namesFile
+	mirrorNamed  bool
+	destParity   bool
+	mirrorParity bool
+}
+
+type treeDiff struct {
+	rel    string
+	reason string
+}
+
+// compareSize checks that dst is present and has the same size as src.
+// It returns an empty string when they match.
+func compareSize(src, dst string) (string, error) {
+	if reason, ok := compareLinks(src, dst); ok {
+		return reason, nil
+	}
+	if reason, ok := compareSpecial(src, dst); ok {
+		return reason, nil
+	}
+	sInfo, err := os.Stat(src)
+	if err != nil {
+		return "", err
+	}
+	dInfo, err := os.Stat(dst)
+	if os.IsNotExist(err) {
+		return "missing", nil
+	} else if err != nil {
+		return "", err
+	}
+
+	if sInfo.Size() != dInfo.Size() {
+		return fmt.Sprintf("size mismatch (%d != %d)", sInfo.Size(), dInfo.Size()), nil
+	}
+	return "", nil
+}
+
+// compareExists checks that dst is present, for content that was
+// transformed on the way and can't be compared with src.
+func compareExists(src, dst string) (string, error) {
+	if _, err := os.Lstat(dst); os.IsNotExist(err) {
+		return "missing", nil
+	} else if err != nil {
+		return "", err
+	}
+	return "", nil
+}
+
+// compareFile checks that dst is present and has the same size and content as src.
+// It returns an empty string when the files match.
+func (a hashAlg) compareFile(src, dst string) (string, error) {
+	if reason, ok := compareLinks(src, dst); ok {
+		return reason, nil
+	}
+	if reason, ok := compareSpecial(src, dst); ok {
+		return reason, nil
+	}
+	if reason, err := compareSize(src, dst); reason != "" || err != nil {
+		return reason, err
+	}
+
+	sSum, err := a.file(src)
+	if err != nil {
+		return "", err
+	}
+	dSum, err := a.file(dst)
+	if err != nil {
+		return "", err
+	}
+	if !bytes.Equal(sSum, dSum) {
+		return "content mismatch", nil
+	}
+	return "", nil
+}
+
+// compareSum checks dst against a hash recorded while it was written.
+func (a hashAlg) compareSum(dst string, sum []byte) (string, error) {
+	dSum, err := a.file(dst)
+	if os.IsNotExist(err) {
+		return "missing", nil
+	} else if err != nil {
+		return "", err
+	}
+	if !bytes.Equal(sum, dSum) {
+		return "content mismatch", nil
+	}
+	return "", nil
+}
+
+var errVerifyFailed = errors.New("verify failed")
+
+// verifyWritten flushes dst to the device, drops it from the page cache so
+// it is really read back, and compares its hash with want.
+func (a hashAlg) verifyWritten(dst string, want []byte) error {
+	f, err := os.Open(dst)
+	if err != nil {
+		return fmt.Errorf("%w: %v", errVerifyFailed, err)
+	}
+	defer f.Close()
+	if err := f.Sync(); err != nil {
+		return fmt.Errorf("%w: %v", errVerifyFailed, err)
+	}
+	dropCache(f)
+
+	h := a.new()
+	if _, err := io.Copy(h, f); err != nil {
+		return fmt.Errorf("%w: %v", errVerifyFailed, err)
+	}
+	if !bytes.Equal(h.Sum(nil), want) {
+		return fmt.Errorf("%w: %s: content mismatch", errVerifyFailed, dst)
+	}
+	return nil
+}
+
+// compareTrees compares every placed source path against the destinations
+// it was written to, skipping copies already checked by a per-disk pass.
+func compareTrees(source string, placed []placement, alg hashAlg) []treeDiff {
+	var diffs []treeDiff
+	for _, p := range placed {
+		if p.dest == "" {
+			diffs = append(diffs, treeDiff{p.rel, "not copied"})
+			continue
+		}
+
+		for _, c := range []struct {
+			dest    string
+			checked bool
+		}{{p.dest, p.destChecked}, {p.mirror, p.mirrorChecked}} {
+			if c.dest == "" || c.checked {
+				continue
+			}
+			if reason := comparePlacement(source, p, c.dest, alg); reason != "" {
+				diffs = append(diffs, treeDiff{p.rel, reason})
+				break
+			}
+		}
+	}
+	return diffs
+}
+
+func comparePlacement(source string, p placement, dest string, alg hashAlg) string {
+	var reason string
+	var err error
+	if p.sum != nil {
+		reason, err = alg.compareSum(filepath.Join(dest, p.dstRel), p.sum)
+	} else {
+		reason, err = alg.compareFile(filepath.Join(source, p.rel), filepath.Join(dest, p.dstRel))
+	}
+	if err != nil {
+		reason = err.Error()
+	}
+	return reason
+}
+
+// verifyDisk checks every copy written to dest so far and records any
+// differences for the final report. Copies are claimed under the lock so
+// a later pass over the same disk only looks at files written since.
+func (s *Session) verifyDisk(dest string) {
+	s.mu.Lock()
+	var claimed []placement
+	for i := range s.placed {
+		p := &s.placed[i]
+		switch {
+		case p.dest == dest && !p.destChecked:
+			p.destChecked = true
+		case p.mirror == dest && !p.mirrorChecked:
+			p.mirrorChecked = true
+		default:
+			continue
+		}
+		claimed = append(claimed, *p)
+	}
+	s.mu.Unlock()
+
+	var diffs []treeDiff
+	for _, p := range claimed {
+		if reason := comparePlacement(s.args.Source, p, dest, s.hash); reason != "" {
+			diffs = append(diffs, treeDiff{p.rel, reason})
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.diffs = append(s.diffs, diffs...)
+	fmt.Fprintf(s.out, "Verified %d files on %s: %d differ\n", len(claimed), dest, len(diffs))
+}
+
+// verifyInBackground starts checking a disk that was just swapped out while
+// copying continues on the next one. The caller must hold s.mu.
+func (s *Session) verifyInBackground(dest string) {
+	if !s.args.VerifyTree || s.args.VerifyPolicy != "background" || dest == "" {
+		return
+	}
+	s.verifyWG.Add(1)
+	go func() {
+		defer s.verifyWG.Done()
+		s.verifyDisk(dest)
+	}()
+}
+
+func (s *Session) verifyTree() error {
+	if s.args.VerifyPolicy == "deferred" {
+		return s.deferVerify()
+	}
+	s.verifyWG.Wait()
+
+	fmt.Fprintf(s.out, "Verifying %d files...\n", len(s.placed))
+	diffs := append(s.diffs, compareTrees(s.args.Source, s.placed, s.hash)...)
+	return s.reportDiffs(diffs, len(s.placed))
+}
+
+// deferVerify saves the paths written to each destination, each with the
+// name it was given there, so the disks can be checked later with verify
+// --resume, possibly on another machine.
+func (s *Session) deferVerify() error {
+	var dests []string
+	byDest := make(map[string][]string)
+	var diffs []treeDiff
+	for _, p := range s.placed {
+		if p.dest == "" {
+			diffs = append(diffs, treeDiff{p.rel, "not copied"})
+			continue
+		}
+		for _, dest := range []string{p.dest, p.mirror} {
+			if dest == "" {
+				continue
+			}
+			if _, ok := byDest[dest]; !ok {
+				dests = append(dests, dest)
+			}
+			byDest[dest] = append(byDest[dest], p.rel+"\t"+p.dstRel)
+		}
+	}
+
+	var flags string
+	if s.args.Normalize != "none" {
+		flags += " --normalize " + s.args.Normalize
+	}
+	if s.args.Sanitize {
+		flags += " --sanitize"
+	}
+	if s.args.PipeSuffix != "" {
+		flags += fmt.Sprintf(" --pipe-suffix %q", s.args.PipeSuffix)
+	}
+	for i, dest := range dests {
+		name := s.savePaths(fmt.Sprintf(".disk%d.verifyfiles", i+1), "Verify", byDest[dest])
+		fmt.Fprintf(s.out, "To verify later: splitcopy verify %q %q --deep --resume %q%s\n", s.args.Source, dest, name, flags)
+	}
+	if len(diffs) > 0 {
+		return s.reportDiffs(diffs, len(s.placed))
+	}
+	return nil
+}
+
+// reportDiffs prints each discrepancy and saves the affected paths as a
+// remaining-files list so they can be recopied with --resume.
+func (s *Session) reportDiffs(diffs []treeDiff, total int) error {
+	if len(diffs) == 0 {
+		fmt.Fprintln(s.out, "Verify passed: destination matches source")
+		return nil
+	}
+
+	var remaining []string
+	for _, d := range diffs {
+		fmt.Fprintf(s.out, "%s: %s\n", d.reason, d.rel)
+		s.emit(Event{Type: EventMismatch, Path: d.rel, Detail: d.reason})
+		remaining = append(remaining, d.rel)
+	}
+	s.saveRemaining(remaining)
+
+	return fmt.Errorf("verify failed: %d of %d files differ", len(diffs), total)
+}
+
+type VerifyCmd struct {
+	Source      string `arg:"" help:"Source directory." type:"existingdir"`
+	Destination string `arg:"" help:"Destination directory." type:"existingdir"`
+
+	ScanFlags `embed:""`
+
+	Deep         bool   `help:"Also compare file contents by hash, not just presence and size."`
+	Hash         string `enum:"sha256,xxh3,blake3" default:"sha256" help:"Hash used by --deep: ${enum}."`
+	Jobs         int    `short:"j" default:"1" help:"Number of files to check in parallel."`
+	Normalize    string `enum:"none,nfc,nfd" default:"none" help:"Unicode normalization the copy applied to destination names: ${enum}."`
+	Sanitize     bool   `help:"Look for files under the names the copy's --sanitize gave them."`
+	PipeSuffix   string `placeholder:"EXT" help:"Look for files under the names the copy's --pipe-suffix gave them. Their content was transformed, so they are only checked for presence."`
+	MaxOpenFiles int    `placeholder:"N" help:"Maximum file descriptors held open across all workers (default: half the soft ulimit)."`
+}
+
+func (v *VerifyCmd) Validate() error {
+	return v.ScanFlags.validate()
+}
+
+func (v *VerifyCmd) Run() error {
+	sess := newSession(&CopyCmd{
+		Source:      v.Source,
+		Destination: v.Destination,
+		ScanFlags:   v.ScanFlags,
+		CopyFlags:   CopyFlags{Hash: v.Hash, MaxOpenFiles: v.MaxOpenFiles, Normalize: v.Normalize, Sanitize: v.Sanitize, PipeSuffix: v.PipeSuffix},
+	})
+	if v.ResumeList != nil {
+		if err := sess.readVerifyList(v.ResumeList); err != nil {
+			return err
+		}
+	}
+	return sess.RunVerify(max(v.Jobs, 1), v.Deep)
+}
+
+// readVerifyList reads the paths to check from a verify --resume list.
+// Lines saved by a deferred --verify-tree also carry the name the file was
+// given on the destination, after a tab.
+func (s *Session) readVerifyList(f *os.File) error {
+	defer f.Close()
+	s.paths = []string{}
+	s.dstNames = make(map[string]string)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		rel, dst, named := strings.Cut(scanner.Text(), "\t")
+		if strings.HasPrefix(rel, planHeader) {
+			continue
+		}
+		if s.args.ExcludeHidden && isHiddenPath(rel) || s.args.excludedPath(rel) {
+			continue
+		}
+		s.paths = append(s.paths, rel)
+		if named {
+			s.dstNames[rel] = dst
+		}
+	}
+	return scanner.Err()
+}
+
+type verifyResult struct {
+	index  int
+	rel    string
+	size   int64
+	reason string
+}
+
+// RunVerify compares scanned paths against the destination without writing
+// to it, by size or with deep also by hash. On interrupt, paths not yet
+// checked are saved as an unverified list that can be passed back to
+// verify --resume.
+func (s *Session) RunVerify(jobs int, deep bool) error {
+	compare := compareSize
+	if s.args.PipeSuffix != "" {
+		compare = compareExists
+	} else if deep {
+		compare = s.hash.compareFile
+	}
+
+	go s.scan()
+
+	work := make(chan verifyResult)
+	results := make(chan verifyResult)
+
+	go func() {
+		defer close(work)
+		for i := s.args.StartIndex; ; i++ {
+			rel, more, _ := s.waitPath(i, nil)
+			if !more {
+				return
+			}
+			work <- verifyResult{index: i, rel: rel}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for range jobs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for r := range work {
+				src := filepath.Join(s.args.Source, r.rel)
+				if info, err := s.args.statSource(src); err == nil {
+					r.size = info.Size()
+				}
+				n := s.fds.acquire(1)
+				name, ok := s.dstNames[r.rel]
+				if !ok {
+					name = s.args.destName(r.rel) + s.args.PipeSuffix
+				}
+				reason, err := compare(src, filepath.Join(s.args.Destination, name))
+				s.fds.release(n)
+				if err != nil {
+					reason = err.Error()
+				}
+				r.reason = reason
+				results <- r
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	done := make(map[int]bool)
+	var diffs []treeDiff
+	for {
+		select {
+		case <-s.sigIntChan:
+			return s.exitWithUnverified(done, diffs)
+
+		case r, more := <-results:
+			if !more {
+				s.finishProgress()
+				if s.scanErr != nil {
+					return s.scanErr
+				}
+				if err := s.checkSelected(s.args.StartIndex); err != nil {
+					return err
+				}
+				if s.args.ResumeList == nil {
+					if err := s.reportExtra(); err != nil {
+						return err
+					}
+				}
+				return s.reportDiffs(diffs, len(done))
+			}
+
+			done[r.index] = true
+			if r.reason != "" {
+				diffs = append(diffs, treeDiff{r.rel, r.reason})
+			}
+			s.progress.Global.Files++
+			s.progress.Global.Bytes += r.size
+			s.progress.Local = s.progress.Global
+			s.currentRel = r.rel
+			if time.Since(s.progress.lastPrintTime) >= progressInterval {
+				s.mu.Lock()
+				s.printProgress()
+				s.mu.Unlock()
+			}
+		}
+	}
+}
+
+// reportExtra lists files in the destination that the source scan didn't
+// find. They can't be recopied, so they are reported but don't fail the
+// verify.
+func (s *Session) reportExtra() error {
+	var extra int
+	_, err := s.walkExtra(s.args.Destination, func(rel string) error {
+		extra++
+		fmt.Fprintf(s.out, "only in destination: %s\n", rel)
+		return nil
+	})
+	if extra > 0 {
+		fmt.Fprintf(s.out, "%d files exist only in the destination\n", extra)
+	}
+	return err
+}
+
+func (s *Session) exitWithUnverified(done map[int]bool, diffs []treeDiff) error {
+	if s.args.ResumeList == nil {
+		fmt.Fprintln(s.out, "\nInterrupt received. Finishing source directory tree scan...")
+	}
+	<-s.scanDone
+
+	var unverified []string
+	for i := s.args.StartIndex; i < len(s.allPaths); i++ {
+		if done[i] {
+			continue
+		}
+		if dst, ok := s.dstNames[s.allPaths[i]]; ok {
+			unverified = append(unverified, s.allPaths[i]+"\t"+dst)
+		} else {
+			unverified = append(unverified, s.allPaths[i])
+		}
+	}
+	var remaining []string
+	for _, d := range diffs {
+		remaining = append(remaining, d.rel)
+	}
+
+	s.saveRemaining(remaining)
+	s.savePaths(".unverifiedfiles", "Unverified", unverified)
+	os.Exit(130)
+	return nil
+}
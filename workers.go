@@ -0,0 +1,258 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"sync"
+)
+
+type copyJob struct {
+	index int
+	rel   string
+	large bool
+}
+
+// copyLoop copies every scanned path from startIndex onwards with a pool
+// of workers. A path only counts as done once it is fully copied, so the
+// remaining-files list stays correct however the workers interleave.
+func (s *Session) copyLoop(startIndex int) error {
+	jobs := max(s.args.Jobs, 1)
+	work := make(chan copyJob)
+	largeDone := make(chan struct{}, jobs)
+	var pending sync.WaitGroup
+	go s.dispatch(startIndex, work, largeDone, &pending)
+	s.watchPause()
+
+	var wg sync.WaitGroup
+	for range jobs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range work {
+				s.waitWhilePaused()
+				s.mu.Lock()
+				s.progress.active++
+				s.mu.Unlock()
+				if err := s.copyWithRetry(job); err != nil {
+					s.stop()
+				}
+				pending.Done()
+				s.mu.Lock()
+				s.progress.active--
+				s.mu.Unlock()
+				if job.large {
+					largeDone <- struct{}{}
+				}
+			}
+		}()
+	}
+
+	finished := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(finished)
+	}()
+
+	go s.tickProgress(finished)
+
+	var reported chan struct{}
+	if s.args.BandwidthReport != "" {
+		reported = make(chan struct{})
+		go func() {
+			s.recordBandwidth(finished)
+			close(reported)
+		}()
+	}
+
+	select {
+	case <-finished:
+	case <-s.sigIntChan:
+		s.stop()
+		<-finished
+	}
+	if reported != nil {
+		<-reported
+	}
+	s.writeSums(s.args.Destination)
+	s.writeSums(s.args.MirrorTo)
+	s.writeRenames(s.args.Destination)
+	s.writeRenames(s.args.MirrorTo)
+	s.writeParity(s.args.Destination)
+	s.writeParity(s.args.MirrorTo)
+	s.createEmptyDirs(s.args.Destination)
+	s.createEmptyDirs(s.args.MirrorTo)
+	s.setDirMetadata(s.args.Destination)
+	s.setDirMetadata(s.args.MirrorTo)
+	s.syncDest(s.args.Destination)
+	s.syncDest(s.args.MirrorTo)
+	if s.interrupted.Load() {
+		return s.exitWithRemaining(startIndex)
+	}
+	if s.scanErr != nil {
+		return s.scanErr
+	}
+
+	s.finishProgress()
+	if sk := s.progress.Skipped; sk.Files > 0 {
+		fmt.Fprintf(s.out, "Skipped %d unchanged files (%s)\n", sk.Files, humanBytes(sk.Bytes))
+	}
+	if sp := s.progress.Sparse; sp.Holes > 0 {
+		fmt.Fprintf(s.out, "Sparse: preserved %d holes in %d files saving %s\n", sp.Holes, sp.Files, humanBytes(sp.Bytes))
+	}
+	if c := s.progress.Cloned; c.Files > 0 {
+		fmt.Fprintf(s.out, "Reflinks: cloned %d files (%s) instead of copying them\n", c.Files, humanBytes(c.Bytes))
+	}
+	if c := s.progress.Chunked; c.Files > 0 {
+		fmt.Fprintf(s.out, "Chunks: split %d files (%s) into %d parts; put them back together with splitcopy join\n", c.Files, humanBytes(c.Bytes), s.progress.ChunkParts)
+	}
+	if l := s.progress.Linked; l.Files > 0 {
+		fmt.Fprintf(s.out, "Hard links: recreated %d instead of copying %s\n", l.Files, humanBytes(l.Bytes))
+	}
+	if d := s.progress.Damaged; d.Files > 0 {
+		fmt.Fprintf(s.out, "Salvage: %d files had %s unreadable, written as zeros\n", d.Files, humanBytes(d.Bytes))
+	}
+	if s.progress.Retries > 0 {
+		fmt.Fprintf(s.out, "Retries: %d after transient I/O errors\n", s.progress.Retries)
+	}
+	if s.progress.SkippedLinks > 0 {
+		fmt.Fprintf(s.out, "Symlinks: left out %d\n", s.progress.SkippedLinks)
+	}
+	if s.progress.SkippedSpecials > 0 {
+		fmt.Fprintf(s.out, "Special files: left out %d FIFOs, sockets, or devices (see --specials)\n", s.progress.SkippedSpecials)
+	}
+	if s.progress.LostStreams > 0 {
+		fmt.Fprintf(s.out, "Streams: %d could not be preserved because the destination doesn't support them\n", s.progress.LostStreams)
+	}
+	if s.progress.LostXattrs > 0 {
+		fmt.Fprintf(s.out, "Xattrs: %d could not be preserved because the destination doesn't support them\n", s.progress.LostXattrs)
+	}
+	if s.progress.LostACLs > 0 {
+		fmt.Fprintf(s.out, "ACLs: %d could not be preserved because the destination doesn't support them\n", s.progress.LostACLs)
+	}
+	s.timings.print(s.out)
+	return nil
+}
+
+// dispatch feeds scanned paths to the workers in order, except that files
+// above --large-file-threshold are held back while --large-file-jobs of
+// them are already being copied. Small files keep flowing to the other
+// workers in the meantime. Files held back by --pack greedy are sent again
+// once everything else is done, on the next destination.
+func (s *Session) dispatch(startIndex int, work chan<- copyJob, largeDone <-chan struct{}, pending *sync.WaitGroup) {
+	defer close(work)
+
+	candidates := make(chan copyJob)
+	go func() {
+		defer close(candidates)
+		send := func(job copyJob) bool {
+			pending.Add(1)
+			select {
+			case candidates <- job:
+				return true
+			case <-s.stopCh:
+				pending.Done()
+				return false
+			}
+		}
+
+		for i := startIndex; ; i++ {
+			rel, more, _ := s.waitPath(i, s.stopCh)
+			if !more {
+				break
+			}
+
+			job := copyJob{index: i, rel: rel}
+			if s.args.LargeFileThreshold > 0 {
+				if info, err := s.args.statSource(filepath.Join(s.args.Source, rel)); err == nil {
+					job.large = info.Size() >= int64(s.args.LargeFileThreshold)
+				}
+			}
+
+			if !send(job) {
+				return
+			}
+		}
+
+		for s.args.Pack == "greedy" {
+			idle := make(chan struct{})
+			go func() {
+				pending.Wait()
+				close(idle)
+			}()
+			select {
+			case <-idle:
+			case <-s.stopCh:
+				return
+			}
+
+			jobs, swap, gen := s.takeDeferred()
+			if len(jobs) == 0 {
+				return
+			}
+			if swap != nil {
+				if err := s.swapDestination(swap, gen); err != nil {
+					s.stop()
+					return
+				}
+			}
+			for _, job := range jobs {
+				if !send(job) {
+					return
+				}
+			}
+		}
+	}()
+
+	var small *copyJob
+	var large []copyJob
+	active := 0
+	in := candidates
+	for in != nil || small != nil || len(large) > 0 {
+		var out chan<- copyJob
+		var next copyJob
+		switch {
+		case len(large) > 0 && active < max(s.args.LargeFileJobs, 1):
+			out, next = work, large[0]
+		case small != nil:
+			out, next = work, *small
+		}
+
+		recv := in
+		if small != nil {
+			recv = nil
+		}
+
+		select {
+		case job, ok := <-recv:
+			if !ok {
+				in = nil
+			} else if job.large {
+				large = append(large, job)
+			} else {
+				small = &job
+			}
+		case out <- next:
+			if next.large {
+				large = large[1:]
+				active++
+			} else {
+				small = nil
+			}
+		case <-largeDone:
+			active--
+		case <-s.stopCh:
+			return
+		}
+	}
+}
+
+func (s *Session) stop() {
+	s.stopOnce.Do(func() {
+		s.interrupted.Store(true)
+		close(s.stopCh)
+
+		s.mu.Lock()
+		s.pauseCond.Broadcast()
+		s.mu.Unlock()
+	})
+}
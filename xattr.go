@@ -0,0 +1,69 @@
+package main
+
+import "strings"
+
+// copyXattrs copies the extended attributes of src to dst, except system.*
+// ones such as ACLs. Attributes the destination filesystem can't hold are
+// returned rather than treated as an error.
+func copyXattrs(src, dst string) (lost []string, err error) {
+	names, err := listXattrs(src)
+	if err != nil {
+		if isUnsupported(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var copied []string
+	for _, name := range names {
+		if !strings.HasPrefix(name, "system.") {
+			copied = append(copied, name)
+		}
+	}
+	return setXattrs(src, dst, copied)
+}
+
+// readXattrs returns the extended attributes of path, except system.* ones,
+// for a manifest. A filesystem without them has none.
+func readXattrs(path string) (map[string][]byte, error) {
+	names, err := listXattrs(path)
+	if err != nil {
+		if isUnsupported(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var attrs map[string][]byte
+	for _, name := range names {
+		if strings.HasPrefix(name, "system.") {
+			continue
+		}
+		data, err := getXattr(path, name)
+		if err != nil {
+			return nil, err
+		}
+		if attrs == nil {
+			attrs = make(map[string][]byte)
+		}
+		attrs[name] = data
+	}
+	return attrs, nil
+}
+
+// setXattrs copies the named attributes from src to dst and returns those
+// that dst doesn't support.
+func setXattrs(src, dst string, names []string) (lost []string, err error) {
+	for _, name := range names {
+		data, err := getXattr(src, name)
+		if err != nil {
+			return lost, err
+		}
+		if err := setXattr(dst, name, data); err != nil {
+			if isUnsupported(err) {
+				lost = append(lost, name)
+				continue
+			}
+			return lost, err
+		}
+	}
+	return lost, nil
+}
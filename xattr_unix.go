@@ -0,0 +1,59 @@
+//go:build unix
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+func listXattrs(path string) ([]string, error) {
+	sz, err := unix.Listxattr(path, nil)
+	if err != nil || sz == 0 {
+		return nil, err
+	}
+	buf := make([]byte, sz)
+	sz, err = unix.Listxattr(path, buf)
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, name := range bytes.Split(buf[:sz], []byte{0}) {
+		if len(name) > 0 {
+			names = append(names, string(name))
+		}
+	}
+	return names, nil
+}
+
+func getXattr(path, name string) ([]byte, error) {
+	sz, err := unix.Getxattr(path, name, nil)
+	if err != nil {
+		return nil, err
+	}
+	buf := make([]byte, sz)
+	sz, err = unix.Getxattr(path, name, buf)
+	if err != nil {
+		return nil, err
+	}
+	return buf[:sz], nil
+}
+
+func setXattr(path, name string, data []byte) error {
+	return unix.Setxattr(path, name, data, 0)
+}
+
+// lsetXattr sets an attribute on a symlink itself.
+func lsetXattr(path, name string, data []byte) error {
+	return unix.Lsetxattr(path, name, data, 0)
+}
+
+// isUnsupported reports whether err means the filesystem can't store the
+// attribute at all, as opposed to a transient or permission failure.
+func isUnsupported(err error) bool {
+	return errors.Is(err, unix.ENOTSUP) || errors.Is(err, unix.EOPNOTSUPP) || errors.Is(err, syscall.EPERM)
+}
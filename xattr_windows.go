@@ -0,0 +1,27 @@
+package main
+
+import "errors"
+
+// Extended attributes in the Linux and macOS sense don't exist on Windows,
+// so there are none to copy and any recorded in a manifest are lost.
+func listXattrs(path string) ([]string, error) {
+	return nil, errors.ErrUnsupported
+}
+
+func getXattr(path, name string) ([]byte, error) {
+	return nil, errors.ErrUnsupported
+}
+
+func setXattr(path, name string, data []byte) error {
+	return errors.ErrUnsupported
+}
+
+func lsetXattr(path, name string, data []byte) error {
+	return errors.ErrUnsupported
+}
+
+// isUnsupported reports whether err means the filesystem can't store the
+// attribute at all.
+func isUnsupported(err error) bool {
+	return errors.Is(err, errors.ErrUnsupported)
+}